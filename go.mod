@@ -3,8 +3,10 @@ module github.com/stencilframe/mdtools
 go 1.23.0
 
 require (
+	github.com/kyokomi/emoji/v2 v2.2.13
 	github.com/russross/blackfriday/v2 v2.1.0
 	github.com/stretchr/testify v1.9.0
+	github.com/yuin/goldmark v1.8.2
 )
 
 require (
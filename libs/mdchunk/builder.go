@@ -0,0 +1,173 @@
+package mdchunk
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// chunkBuilder assembles the chunks of a list of nodes in a single buffer.
+// The chunks of the children are read in place by their parent, and the chunks
+// of the document are substrings of a single string, so that the text is only
+// copied once per level of the tree.
+type chunkBuilder struct {
+	buf   bytes.Buffer
+	start int   // Offset of the current chunk
+	ends  []int // End offsets of the finalized chunks
+
+	definitions map[string]string // Definitions of the reference links and the inlined ^footnotes by label, nil when not tracked
+	labels      []string          // Definitions referenced by the current chunk
+	notes       int               // Length of the definitions referenced by the current chunk
+	refs        [][]string        // Definitions referenced by the finalized chunks
+}
+
+// Len returns the length of the current chunk, with the definitions it references
+func (b *chunkBuilder) Len() int {
+	return b.buf.Len() - b.start + b.notes
+}
+
+// textLen returns the length of the current chunk, without the definitions it references
+func (b *chunkBuilder) textLen() int {
+	return b.buf.Len() - b.start
+}
+
+// WriteString appends the text to the current chunk
+func (b *chunkBuilder) WriteString(text string) {
+	b.buf.WriteString(text)
+}
+
+// Write appends the text to the current chunk
+func (b *chunkBuilder) Write(text []byte) {
+	b.buf.Write(text)
+}
+
+// flush finalizes the current chunk and starts the next one with the prefix
+func (b *chunkBuilder) flush(prefix string) {
+	b.ends = append(b.ends, b.buf.Len())
+	if b.definitions != nil {
+		b.refs = append(b.refs, b.labels)
+		b.labels, b.notes = nil, 0
+	}
+	b.start = b.buf.Len()
+	b.buf.WriteString(prefix)
+}
+
+// flushOver finalizes the current chunk when it exceeds the limit
+func (b *chunkBuilder) flushOver(charLimit int) {
+	if b.Len() > charLimit {
+		b.flush("")
+	}
+}
+
+// add appends the part to the current chunk, finalizing the current chunk first
+// when the part does not fit
+func (b *chunkBuilder) add(part string, charLimit int) {
+	if b.Len() > 0 && b.Len()+len(part) > charLimit {
+		b.flush("")
+	}
+	b.buf.WriteString(part)
+}
+
+// addReference appends the part to the current chunk, finalizing the current chunk first
+// when the part and the definitions it references do not fit
+func (b *chunkBuilder) addReference(part string, charLimit int, labels ...string) {
+	if b.Len() > 0 && b.Len()+len(part)+b.notesLen(labels) > charLimit {
+		b.flush("")
+	}
+	b.buf.WriteString(part)
+	b.reference(labels...)
+}
+
+// reference records the definitions referenced by the current chunk, which are appended to it
+func (b *chunkBuilder) reference(labels ...string) {
+	b.notes += b.notesLen(labels)
+	for _, label := range labels {
+		if _, ok := b.definitions[label]; ok && !slices.Contains(b.labels, label) {
+			b.labels = append(b.labels, label)
+		}
+	}
+}
+
+// notesLen returns the length the definitions add to the current chunk, without
+// the definitions which are not tracked or already referenced by the chunk
+func (b *chunkBuilder) notesLen(labels []string) int {
+	n, first := 0, len(b.labels) == 0
+	for i, label := range labels {
+		definition, ok := b.definitions[label]
+		if !ok || slices.Contains(b.labels, label) || slices.Contains(labels[:i], label) {
+			continue
+		}
+		n += len("\n\n") + len(definition)
+		if first {
+			n += len("\n\n") // The definitions end the chunk with a blank line
+			first = false
+		}
+	}
+	return n
+}
+
+// finish finalizes the last chunk, unless it is empty
+func (b *chunkBuilder) finish() {
+	if b.Len() > 0 {
+		b.flush("")
+	}
+}
+
+// count returns the number of finalized chunks
+func (b *chunkBuilder) count() int {
+	return len(b.ends)
+}
+
+// chunk returns the finalized chunk i, it is valid until the builder is reset
+func (b *chunkBuilder) chunk(i int) []byte {
+	start := 0
+	if i > 0 {
+		start = b.ends[i-1]
+	}
+	return b.buf.Bytes()[start:b.ends[i]]
+}
+
+// references returns the definitions referenced by the finalized chunk i
+func (b *chunkBuilder) references(i int) []string {
+	if i >= len(b.refs) {
+		return nil
+	}
+	return b.refs[i]
+}
+
+// partLen returns the length the finalized chunk i of the children adds to the current chunk,
+// with the definitions it references which the current chunk does not reference yet
+func (b *chunkBuilder) partLen(children *chunkBuilder, i int) int {
+	return len(children.chunk(i)) + b.notesLen(children.references(i))
+}
+
+// strings returns the finalized chunks as substrings of a single copy of the buffer,
+// followed by the definitions they reference
+func (b *chunkBuilder) strings() []string {
+	text := b.buf.String()
+	chunks := make([]string, len(b.ends))
+	start := 0
+	for i, end := range b.ends {
+		chunks[i] = text[start:end]
+		if labels := b.references(i); len(labels) > 0 {
+			var sb strings.Builder
+			sb.WriteString(strings.TrimRight(chunks[i], "\n"))
+			for _, label := range labels {
+				sb.WriteString("\n\n" + b.definitions[label])
+			}
+			sb.WriteString("\n\n")
+			chunks[i] = sb.String()
+		}
+		start = end
+	}
+	return chunks
+}
+
+// reset empties the builder, keeping its memory
+func (b *chunkBuilder) reset() {
+	b.buf.Reset()
+	b.start = 0
+	b.ends = b.ends[:0]
+	b.definitions, b.labels, b.notes = nil, nil, 0
+	b.refs = b.refs[:0]
+}
@@ -1,143 +1,440 @@
 package mdchunk
 
 import (
-	"fmt"
-	"io"
+	"bytes"
+	"context"
+	"strings"
 
-	"github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 	"github.com/stencilframe/mdtools/libs/mdtojson"
 )
 
 // Charecter limit per chunk (e.g., 4000 charecters)
 const defaultCharLimit = 4000
 
+// Size limit of the pages transcluded into a document, bounding the expansion of the repeated embeds
+const defaultTransclusionBytes = 16 << 20
+
+// ImageMode defines how images are written into the chunks
+type ImageMode int
+
+const (
+	// ImageModeReference replaces images with {IMG:n} placeholders (default)
+	ImageModeReference ImageMode = iota
+	// ImageModeInline keeps images as inline markdown ![alt](url)
+	ImageModeInline
+	// ImageModeAltText replaces images with their alt text as [Image: alt]
+	ImageModeAltText
+	// ImageModeStrip removes images from the chunks
+	ImageModeStrip
+)
+
 // MarkdownChunk represents a chunk of the markdown document.
+// It holds no state of the documents, once configured it can be shared between goroutines.
 type MarkdownChunk struct {
-	CharCount int // Number of charecters in the chunk
+	CharCount       int       // Number of charecters in the chunk
+	ImageMode       ImageMode // How images are written into the chunks
+	InlineFootnotes bool      // Pull the footnotes into the chunks referencing them
+
+	DefinitionListMode DefinitionListMode // How definition lists are written into the chunks
+	DiagramMode        DiagramMode        // How diagram sources are written into the chunks
+	TransclusionDir    string             // Directory of the pages transcluded by the ![[Page]] embeds, when set
+	TransclusionPage   string             // Page of the chunked document in the transclusion directory, when known
+	TransclusionBytes  int                // Total size of the pages transcluded into a document, 0 for no limit
+
+	rendererOptions []mdtojson.Option // Options of the JSON renderer
 }
 
-// NewDefaultMarkdownChunk creates a new MarkdownChunk.
-func NewDefaultMarkdownChunk() *MarkdownChunk {
-	return &MarkdownChunk{
-		CharCount: defaultCharLimit,
+// Option defines the functional option type
+type Option func(mc *MarkdownChunk)
+
+// WithImageMode sets how images are written into the chunks
+func WithImageMode(mode ImageMode) Option {
+	return func(mc *MarkdownChunk) {
+		mc.ImageMode = mode
+	}
+}
+
+// WithDefinitionListMode sets how definition lists are written into the chunks
+func WithDefinitionListMode(mode DefinitionListMode) Option {
+	return func(mc *MarkdownChunk) {
+		mc.DefinitionListMode = mode
+	}
+}
+
+// WithDiagramMode sets how diagram sources are written into the chunks
+func WithDiagramMode(mode DiagramMode) Option {
+	return func(mc *MarkdownChunk) {
+		mc.DiagramMode = mode
+	}
+}
+
+// WithInlineFootnotes pulls the text of each footnote into the chunks referencing it,
+// instead of chunking the footnote definitions at the end of the document.
+// The text of the footnotes counts towards the size of the chunks.
+func WithInlineFootnotes() Option {
+	return func(mc *MarkdownChunk) {
+		mc.InlineFootnotes = true
+	}
+}
+
+// WithParserConfig sets the configuration of the markdown parser
+func WithParserConfig(config *mdparser.Config) Option {
+	return func(mc *MarkdownChunk) {
+		mc.rendererOptions = append(mc.rendererOptions, mdtojson.WithParserConfig(config))
 	}
 }
 
+// WithRendererOptions sets the options of the JSON renderer used to parse the markdown
+func WithRendererOptions(options ...mdtojson.Option) Option {
+	return func(mc *MarkdownChunk) {
+		mc.rendererOptions = append(mc.rendererOptions, options...)
+	}
+}
+
+// NewDefaultMarkdownChunk creates a new MarkdownChunk.
+func NewDefaultMarkdownChunk(options ...Option) *MarkdownChunk {
+	return NewMarkdownChunk(defaultCharLimit, options...)
+}
+
 // NewMarkdownChunk creates a new MarkdownChunk with custom charecter limit.
-func NewMarkdownChunk(charLimit int) *MarkdownChunk {
-	return &MarkdownChunk{
-		CharCount: charLimit,
+func NewMarkdownChunk(charLimit int, options ...Option) *MarkdownChunk {
+	mc := &MarkdownChunk{
+		CharCount:         charLimit,
+		TransclusionBytes: defaultTransclusionBytes,
 	}
+	for _, option := range options {
+		option(mc)
+	}
+	return mc
+}
+
+// Result is the result of the chunking of a markdown document
+type Result struct {
+	Chunks   []string            // Chunks of the document, in order
+	Images   []mdtojson.ImageRef // Image references used by the chunks
+	Warnings []mdparser.Warning  // Non-fatal problems found during the parsing and the chunking
+}
+
+// chunkState is the state of the chunking of a document
+type chunkState struct {
+	ctx         context.Context    // Context of the chunking, checked between the nodes
+	usedImages  map[int]bool       // Image references written into the chunks
+	warnings    []mdparser.Warning // Non-fatal problems found during the chunking
+	builders    []*chunkBuilder    // Chunk builders released by the levels of the tree, reused by the next ones
+	definitions map[string]string  // Definitions of the reference links and the inlined ^footnotes by label
+	transcluded int                // Bytes of the pages transcluded into the document
+}
+
+func newChunkState(ctx context.Context) *chunkState {
+	return &chunkState{ctx: ctx, usedImages: map[int]bool{}, definitions: map[string]string{}}
+}
+
+// checkContext aborts the chunking with ctx.Err() once the context is done
+func (s *chunkState) checkContext() {
+	if err := s.ctx.Err(); err != nil {
+		mdparser.Abort(err)
+	}
+}
+
+// getBuilder returns an empty chunk builder, it is released with putBuilder
+func (s *chunkState) getBuilder() *chunkBuilder {
+	if len(s.builders) == 0 {
+		return &chunkBuilder{definitions: s.definitions}
+	}
+	b := s.builders[len(s.builders)-1]
+	s.builders = s.builders[:len(s.builders)-1]
+	b.definitions = s.definitions
+	return b
+}
+
+// putBuilder releases the chunk builder, its chunks must not be used afterwards
+func (s *chunkState) putBuilder(b *chunkBuilder) {
+	b.reset()
+	s.builders = append(s.builders, b)
+}
+
+// warn records a node which does not implement the node type it reports, it is left out of the chunks
+func (s *chunkState) warn(node mdtojson.Node) {
+	s.warnings = append(s.warnings, mdparser.Warnf(mdparser.WarningNode, "%s node of type %T is not chunked", node.GetType(), node))
 }
 
 // ChunkMarkdown splits the markdown data into chunks.
-func (mc *MarkdownChunk) ChunkMarkdown(markdownData []byte) (chunks []string, images map[string]string) {
-	// Parse the markdown into a syntax tree
-	parser := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions | blackfriday.AutoHeadingIDs | blackfriday.Tables))
-	node := parser.Parse(markdownData)
+// The returned images only contain the references used by the chunks.
+// An unexpected failure of the chunking is returned as an *mdparser.InternalError.
+func (mc *MarkdownChunk) ChunkMarkdown(markdownData []byte) (chunks []string, images []mdtojson.ImageRef, err error) {
+	return mc.ChunkMarkdownContext(context.Background(), markdownData)
+}
 
-	// Create a new JSONRenderer
-	renderer := mdtojson.NewJSONRenderer()
+// ChunkMarkdownContext splits the markdown data into chunks, see Convert for the errors
+func (mc *MarkdownChunk) ChunkMarkdownContext(ctx context.Context, markdownData []byte) (chunks []string, images []mdtojson.ImageRef, err error) {
+	result, err := mc.Convert(ctx, markdownData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.Chunks, result.Images, nil
+}
 
-	// Walk the parsed syntax tree with our custom renderer
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		return renderer.RenderNode(io.Discard, n, entering)
-	})
-	nodes := renderer.GetNodes()
-	chunks = mc.ChunkJSONMarkdown(mc.CharCount, nodes)
-	images = renderer.GetImageURLs()
-	return chunks, images
+// Convert splits the markdown data into chunks, with the image references used by the chunks
+// and the warnings of the conversion. The context is checked between the blocks and the table rows,
+// the conversion returns ctx.Err() once it is done. The documents over the limits of the parser
+// configuration are rejected with a *mdparser.LimitError, and the unexpected failures are
+// returned as an *mdparser.InternalError.
+func (mc *MarkdownChunk) Convert(ctx context.Context, markdownData []byte) (result Result, err error) {
+	defer mdparser.Recover(&err)
+
+	// Parse the markdown into JSON nodes
+	renderer := mdtojson.NewJSONRenderer(mc.rendererOptionsList()...)
+	parsed, err := renderer.Convert(ctx, markdownData)
+	if err != nil {
+		return Result{}, err
+	}
+	nodes := parsed.Nodes
+	state := newChunkState(ctx)
+	if mc.TransclusionDir != "" {
+		mc.transclude(renderer, nodes, mc.transclusionRoot(), state)
+	}
+	if mc.InlineFootnotes {
+		nodes = mc.extractFootnotes(nodes, state)
+	}
+	result.Chunks = mc.chunkJSONMarkdown(mc.CharCount, nodes, state)
+
+	// Keep only the images referenced by the chunks
+	result.Images = []mdtojson.ImageRef{}
+	for _, ref := range renderer.GetImageRefs() {
+		if state.usedImages[ref.Reference] {
+			result.Images = append(result.Images, ref)
+		}
+	}
+	result.Warnings = append(parsed.Warnings, state.warnings...)
+	return result, nil
 }
 
 // ChunkJSONMarkdown splits the JSON markdown data into chunks.
+// The chunks end with the definitions of the reference links they use.
 func (mc *MarkdownChunk) ChunkJSONMarkdown(charLimit int, markdownData []mdtojson.Node) []string {
-	chunks := []string{}
-	currentChunk := ""
+	return mc.chunkJSONMarkdown(charLimit, markdownData, newChunkState(context.Background()))
+}
+
+// chunkJSONMarkdown splits the JSON markdown data into chunks,
+// collecting the image references written into the chunks.
+func (mc *MarkdownChunk) chunkJSONMarkdown(charLimit int, markdownData []mdtojson.Node, state *chunkState) []string {
+	current := mc.buildChunks(charLimit, markdownData, state)
+	defer state.putBuilder(current)
+	return current.strings()
+}
+
+// buildChunks splits the JSON markdown data into the chunks of a builder,
+// which is released with state.putBuilder
+func (mc *MarkdownChunk) buildChunks(charLimit int, markdownData []mdtojson.Node, state *chunkState) *chunkBuilder {
+	current := state.getBuilder()
 
 	for i := 0; i < len(markdownData); i++ {
+		state.checkContext()
 		switch markdownData[i].GetType() {
 		case mdtojson.NodeTypeTable:
 			// Chunk tables separately
 			table, ok := markdownData[i].(*mdtojson.TableNode)
 			if !ok {
-				fmt.Println("Error: Unable to cast to TableNode")
+				state.warn(markdownData[i])
 				continue
 			}
-			tableChunks := table.ChunkTable(charLimit-len(currentChunk), charLimit)
-			if len(tableChunks) == 0 {
+			// Append the first table chunk to the current chunk,
+			// the next ones are complete chunks except the last one
+			count := 0
+			for tableChunk, err := range table.Chunks(charLimit-current.Len(), charLimit) {
+				state.checkContext()
+				if err != nil {
+					state.warnings = append(state.warnings, mdparser.Warnf(mdparser.WarningNode, "%v", err))
+					continue
+				}
+				if count > 0 {
+					current.flush("")
+				}
+				current.WriteString(tableChunk)
+				count++
+			}
+			if count == 0 {
 				continue
 			}
 
-			// Append the first table chunk to the current chunk
-			tableChunks[0] = currentChunk + tableChunks[0]
-			// Append all but the last table chunk to the chunks list
-			chunks = append(chunks, tableChunks[:len(tableChunks)-1]...)
-
-			currentChunk = tableChunks[len(tableChunks)-1]
 			// If the current chunk is too large, finalize it
-			if len(currentChunk) > charLimit {
-				chunks = append(chunks, currentChunk)
-				currentChunk = ""
-			}
+			current.flushOver(charLimit)
 
 			continue
 		case mdtojson.NodeTypeImage:
 			// Extract images
 			image, ok := markdownData[i].(*mdtojson.ImageNode)
 			if !ok {
-				fmt.Println("Error: Unable to cast to ImageNode")
+				state.warn(markdownData[i])
 				continue
 			}
 
-			// Add the image reference to the current chunk
-			currentChunk += image.ToReference()
+			// Add the image to the current chunk
+			current.WriteString(mc.renderImage(image, state))
 
 			// If the current chunk is too large, finalize it
-			if len(currentChunk) > charLimit {
-				chunks = append(chunks, currentChunk)
-				currentChunk = ""
+			current.flushOver(charLimit)
+
+			continue
+		case mdtojson.NodeTypeDefinitionList:
+			// Chunk definition lists by term
+			for _, part := range mc.definitionListParts(markdownData[i]) {
+				current.addReference(part.text, charLimit, state.linkReferences(part.nodes...)...)
+			}
+
+			continue
+		case mdtojson.NodeTypeContainer:
+			// Chunk containers by content, repeating the fences around each part
+			container, ok := markdownData[i].(*mdtojson.ContainerNode)
+			if !ok {
+				state.warn(markdownData[i])
+				continue
+			}
+			opening, closing := container.ToMarkdown(), container.ClosingMarkdown()
+			children := mc.buildChunks(charLimit-len(opening)-len(closing), container.GetChildren(), state)
+			for j := 0; j < children.count(); j++ {
+				child := bytes.TrimRight(children.chunk(j), "\n")
+				if current.Len() > 0 && current.Len()+len(opening)+current.partLen(children, j)+1+len(closing) > charLimit {
+					current.flush("")
+				}
+				current.WriteString(opening)
+				current.Write(child)
+				current.WriteString("\n")
+				current.WriteString(closing)
+				current.reference(children.references(j)...)
+			}
+			state.putBuilder(children)
+
+			continue
+		case mdtojson.NodeTypeMath, mdtojson.NodeTypeMathBlock:
+			// Math is never split, it starts a new chunk when it does not fit
+			current.add(markdownData[i].ToMarkdown(), charLimit)
+
+			continue
+		case mdtojson.NodeTypeDiagram:
+			// Diagrams are never split, they start a new chunk when they do not fit
+			diagram, ok := markdownData[i].(*mdtojson.DiagramNode)
+			if !ok {
+				state.warn(markdownData[i])
+				continue
 			}
+			current.add(mc.renderDiagram(diagram), charLimit)
+
+			continue
+		case mdtojson.NodeTypeEmbed:
+			// Transcluded embeds are chunked with their content, the others keep the wiki syntax
+			childs := markdownData[i].GetChildren()
+			if len(childs) == 0 {
+				current.WriteString(markdownData[i].ToMarkdown())
+				current.flushOver(charLimit)
+				continue
+			}
+			children := mc.buildChunks(charLimit, childs, state)
+			for j := 0; j < children.count(); j++ {
+				if current.Len() > 0 && current.Len()+current.partLen(children, j) > charLimit {
+					current.flush("")
+				}
+				current.Write(children.chunk(j))
+				current.reference(children.references(j)...)
+			}
+			state.putBuilder(children)
+
+			continue
+		case mdtojson.NodeTypeFootnoteRef:
+			// Footnote references bring the definition of their footnote into the chunk when it is inlined
+			ref, ok := markdownData[i].(*mdtojson.FootnoteRefNode)
+			if !ok {
+				state.warn(markdownData[i])
+				continue
+			}
+			current.addReference(ref.ToMarkdown(), charLimit, "^"+ref.Label)
+
+			continue
+		case mdtojson.NodeTypeLink:
+			// Links are rendered with their text, without chunking the children,
+			// the reference links bring their definition into the chunk
+			current.addReference(markdownData[i].ToMarkdown(), charLimit, state.linkReferences(markdownData[i])...)
+
+			// If the current chunk is too large, finalize it
+			current.flushOver(charLimit)
 
 			continue
 		}
 
+		// The section is rendered once, it is repeated at the start of the chunks of its children
 		section := markdownData[i].ToMarkdown()
-		sectionLen := len(section)
-		currentChunk += section
+		var labels []string // Reference links of the heading text
+		if heading, ok := markdownData[i].(*mdtojson.HeadingNode); ok {
+			labels = state.linkReferences(heading.Inline...)
+		}
+		current.WriteString(section)
+		current.reference(labels...)
 
 		// Process the children of the current node first
 		childs := markdownData[i].GetChildren()
 		if childs != nil {
-			childrenChunks := mc.ChunkJSONMarkdown(charLimit-sectionLen, childs)
-
-			for _, child := range childrenChunks {
+			children := mc.buildChunks(charLimit-len(section), childs, state)
+			for j := 0; j < children.count(); j++ {
 				// Try to append the child to the current chunk
-				if len(currentChunk)+len(child) > charLimit {
+				if current.Len()+current.partLen(children, j) > charLimit {
 					// If the current chunk is too large, finalize it
-					chunks = append(chunks, currentChunk)
-					currentChunk = section // Reset to the parent section, continuing the structure
+					current.flush(section) // Reset to the parent section, continuing the structure
+					current.reference(labels...)
 				}
-				currentChunk += child
+				current.Write(children.chunk(j))
+				current.reference(children.references(j)...)
 			}
+			state.putBuilder(children)
 		}
 
 		if markdownData[i].GetType() == mdtojson.NodeTypeParagraph {
-			currentChunk += "\n\n"
+			current.WriteString("\n\n")
 		}
 
-		if currentChunk != section {
-			// If the section alone is larger than charLimit, add it as a single chunk
-			if len(currentChunk) > charLimit {
-				chunks = append(chunks, currentChunk)
-				currentChunk = section // Reset to the current section
-			}
+		// The current chunk holds more than the section when it is longer,
+		// if the section alone is larger than charLimit, add it as a single chunk
+		if current.textLen() != len(section) && current.Len() > charLimit {
+			current.flush(section) // Reset to the current section
+			current.reference(labels...)
 		}
 	}
 
-	// Add any remaining content in currentChunk as the last chunk
-	if len(currentChunk) > 0 {
-		chunks = append(chunks, currentChunk)
+	// Add any remaining content in the current chunk as the last chunk
+	current.finish()
+	return current
+}
+
+// linkReferences returns the labels of the reference links of the nodes and their children,
+// registering their definitions
+func (s *chunkState) linkReferences(nodes ...mdtojson.Node) []string {
+	var labels []string
+	for _, node := range nodes {
+		if link, ok := node.(*mdtojson.LinkNode); ok && link.Kind == mdtojson.LinkKindReference {
+			label := strings.ToLower(link.Label)
+			if _, ok := s.definitions[label]; !ok {
+				s.definitions[label] = link.ToDefinition()
+			}
+			labels = append(labels, label)
+		}
+		labels = append(labels, s.linkReferences(node.GetChildren()...)...)
 	}
+	return labels
+}
 
-	return chunks
+// renderImage renders the image according to the image mode
+func (mc *MarkdownChunk) renderImage(image *mdtojson.ImageNode, state *chunkState) string {
+	switch mc.ImageMode {
+	case ImageModeInline:
+		return image.ToInline()
+	case ImageModeAltText:
+		return image.ToAltText()
+	case ImageModeStrip:
+		return ""
+	default:
+		if !image.Dropped {
+			state.usedImages[image.Reference] = true
+		}
+		return image.ToReference()
+	}
 }
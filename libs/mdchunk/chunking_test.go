@@ -1,12 +1,19 @@
 package mdchunk
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	"github.com/stencilframe/mdtools/libs/mdtojson"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,6 +24,12 @@ func TestChunking(t *testing.T) {
 		expectedChunksFileName string
 		expectedImagesFileName string
 		chunkSize              int
+		imageMode              ImageMode
+		inlineFootnotes        bool
+		definitionListMode     DefinitionListMode
+		diagramMode            DiagramMode
+		transclusionDir        string
+		parserConfig           *mdparser.Config
 	}{
 		{
 			name:                   "Headers",
@@ -37,6 +50,97 @@ func TestChunking(t *testing.T) {
 			expectedImagesFileName: "testdata/images.chunked.json",
 			chunkSize:              100,
 		},
+		{
+			name:                   "ImagesInline",
+			inputFileName:          "testdata/images.md",
+			expectedChunksFileName: "testdata/images.inline.chunked.md",
+			expectedImagesFileName: "testdata/images.none.chunked.json",
+			chunkSize:              100,
+			imageMode:              ImageModeInline,
+		},
+		{
+			name:                   "ImagesAltText",
+			inputFileName:          "testdata/images.md",
+			expectedChunksFileName: "testdata/images.alttext.chunked.md",
+			expectedImagesFileName: "testdata/images.none.chunked.json",
+			chunkSize:              100,
+			imageMode:              ImageModeAltText,
+		},
+		{
+			name:                   "ImagesStrip",
+			inputFileName:          "testdata/images.md",
+			expectedChunksFileName: "testdata/images.strip.chunked.md",
+			expectedImagesFileName: "testdata/images.none.chunked.json",
+			chunkSize:              100,
+			imageMode:              ImageModeStrip,
+		},
+		{
+			name:                   "Footnotes",
+			inputFileName:          "testdata/footnotes.md",
+			expectedChunksFileName: "testdata/footnotes.chunked.md",
+			chunkSize:              200,
+		},
+		{
+			name:                   "FootnotesInline",
+			inputFileName:          "testdata/footnotes.md",
+			expectedChunksFileName: "testdata/footnotes.inline.chunked.md",
+			chunkSize:              250,
+			inlineFootnotes:        true,
+		},
+		{
+			name:                   "Definitions",
+			inputFileName:          "testdata/definitions.md",
+			expectedChunksFileName: "testdata/definitions.chunked.md",
+			chunkSize:              150,
+		},
+		{
+			name:                   "DefinitionsLines",
+			inputFileName:          "testdata/definitions.md",
+			expectedChunksFileName: "testdata/definitions.lines.chunked.md",
+			chunkSize:              150,
+			definitionListMode:     DefinitionListModeLines,
+		},
+		{
+			name:                   "Containers",
+			inputFileName:          "testdata/containers.md",
+			expectedChunksFileName: "testdata/containers.chunked.md",
+			chunkSize:              150,
+		},
+		{
+			name:                   "Math",
+			inputFileName:          "testdata/math.md",
+			expectedChunksFileName: "testdata/math.chunked.md",
+			chunkSize:              100,
+			parserConfig:           mdparser.NewConfig(mdparser.WithMath()),
+		},
+		{
+			name:                   "Diagrams",
+			inputFileName:          "testdata/diagrams.md",
+			expectedChunksFileName: "testdata/diagrams.chunked.md",
+			chunkSize:              300,
+		},
+		{
+			name:                   "DiagramsSummary",
+			inputFileName:          "testdata/diagrams.md",
+			expectedChunksFileName: "testdata/diagrams.summary.chunked.md",
+			chunkSize:              300,
+			diagramMode:            DiagramModeSummary,
+		},
+		{
+			name:                   "DiagramsExclude",
+			inputFileName:          "testdata/diagrams.md",
+			expectedChunksFileName: "testdata/diagrams.exclude.chunked.md",
+			chunkSize:              300,
+			diagramMode:            DiagramModeExclude,
+		},
+		{
+			name:                   "Transclusion",
+			inputFileName:          "testdata/transclusion.md",
+			expectedChunksFileName: "testdata/transclusion.chunked.md",
+			expectedImagesFileName: "testdata/transclusion.chunked.json",
+			chunkSize:              200,
+			transclusionDir:        "testdata/wiki",
+		},
 
 		// TODO: Implement the following tests
 		// {
@@ -58,10 +162,21 @@ func TestChunking(t *testing.T) {
 			assert.NoError(t, err)
 
 			// Initialize a new JSONRenderer
-			chunker := NewMarkdownChunk(tt.chunkSize)
+			options := []Option{WithImageMode(tt.imageMode), WithDefinitionListMode(tt.definitionListMode), WithDiagramMode(tt.diagramMode)}
+			if tt.inlineFootnotes {
+				options = append(options, WithInlineFootnotes())
+			}
+			if tt.transclusionDir != "" {
+				options = append(options, WithTransclusion(tt.transclusionDir))
+			}
+			if tt.parserConfig != nil {
+				options = append(options, WithParserConfig(tt.parserConfig))
+			}
+			chunker := NewMarkdownChunk(tt.chunkSize, options...)
 
 			// Chunk the markdown
-			chunks, images := chunker.ChunkMarkdown(markdownData)
+			chunks, images, err := chunker.ChunkMarkdown(markdownData)
+			assert.NoError(t, err)
 
 			results := ""
 			for i, chunk := range chunks {
@@ -79,7 +194,7 @@ func TestChunking(t *testing.T) {
 			if tt.expectedImagesFileName != "" {
 				expectedImagesData, err := os.ReadFile(tt.expectedImagesFileName)
 				assert.NoError(t, err)
-				expectedImages := map[string]string{}
+				expectedImages := []mdtojson.ImageRef{}
 				err = json.Unmarshal(expectedImagesData, &expectedImages)
 				assert.NoError(t, err)
 				// NOTICE the order of the images is important
@@ -88,3 +203,309 @@ func TestChunking(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONTableRoundTrip(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/tables.md")
+	assert.NoError(t, err)
+
+	// tableRows collects the JSON of the table rows, in document order
+	tableRows := func(nodes []mdtojson.Node) []string {
+		rows := []string{}
+		var walk func(nodes []mdtojson.Node)
+		walk = func(nodes []mdtojson.Node) {
+			for _, node := range nodes {
+				if table, ok := node.(*mdtojson.TableNode); ok {
+					// One row per chunk, the first chunk is left empty by the limit
+					chunks, err := table.ChunkTable(1, 1)
+					assert.NoError(t, err)
+					rows = append(rows, chunks[1:]...)
+				}
+				walk(node.GetChildren())
+			}
+		}
+		walk(nodes)
+		return rows
+	}
+
+	nodes, err := mdtojson.NewJSONRenderer().Parse(markdownData)
+	assert.NoError(t, err)
+	expected := tableRows(nodes)
+
+	// The json_table containers of the chunks are parsed back into tables
+	chunks, _, err := NewMarkdownChunk(1000).ChunkMarkdown(markdownData)
+	assert.NoError(t, err)
+	actual := []string{}
+	for _, chunk := range chunks {
+		nodes, err := mdtojson.NewJSONRenderer().Parse([]byte(chunk))
+		assert.NoError(t, err)
+		actual = append(actual, tableRows(nodes)...)
+	}
+
+	assert.NotEmpty(t, expected)
+	assert.Equal(t, expected, actual)
+}
+
+func TestConvert(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/transclusion.md")
+	assert.NoError(t, err)
+	chunker := NewMarkdownChunk(200, WithTransclusion("testdata/wiki"))
+
+	result, err := chunker.Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+	chunks, images, err := chunker.ChunkMarkdown(markdownData)
+	assert.NoError(t, err)
+	assert.Equal(t, chunks, result.Chunks)
+	assert.Equal(t, images, result.Images)
+	if assert.Len(t, result.Warnings, 1) {
+		assert.Equal(t, mdparser.WarningTransclusion, result.Warnings[0].Kind)
+		assert.Contains(t, result.Warnings[0].Message, `embed "Missing page"`)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = chunker.Convert(ctx, markdownData)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTransclusionLimits(t *testing.T) {
+	// The document is the page it embeds, the embed closes a cycle
+	chunker := NewMarkdownChunk(1000, WithTransclusion("testdata/wiki"), WithTransclusionPage("Architecture"))
+	result, err := chunker.Convert(context.Background(), []byte("# Architecture\n\n![[Architecture]]\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"# Architecture\n\n![[Architecture]]"}, result.Chunks)
+	assert.Empty(t, result.Warnings)
+
+	// The pages over the total size are not transcluded, Architecture embeds Storage
+	architecture, err := os.ReadFile("testdata/wiki/Architecture.md")
+	assert.NoError(t, err)
+	storage, err := os.ReadFile("testdata/wiki/Storage.md")
+	assert.NoError(t, err)
+	limit := len(architecture) + len(storage) - 1
+	chunker = NewMarkdownChunk(1000, WithTransclusion("testdata/wiki"), WithTransclusionLimit(limit))
+	result, err = chunker.Convert(context.Background(), []byte("![[Architecture]]\n"))
+	assert.NoError(t, err)
+	if assert.Len(t, result.Chunks, 1) {
+		assert.Contains(t, result.Chunks[0], "replicated key-value store")
+		assert.NotContains(t, result.Chunks[0], "acknowledged by two replicas")
+	}
+	assert.Equal(t, []mdparser.Warning{{
+		Kind:    mdparser.WarningLimit,
+		Message: fmt.Sprintf(`embed "Storage": transcluded pages over the limit of %d bytes`, limit),
+	}}, result.Warnings)
+}
+
+func TestInlineFootnotes(t *testing.T) {
+	markdownData := []byte("The first claim[^a] and `[^b]` in code.\n\n" +
+		"The second claim[^b] is long enough to be chunked apart from the first one.\n\n" +
+		"[^a]: First footnote with a rather long text.\n\n" +
+		"[^b]: Second footnote with a rather long text.\n")
+	chunker := NewMarkdownChunk(130, WithInlineFootnotes())
+
+	chunks, _, err := chunker.ChunkMarkdown(markdownData)
+	assert.NoError(t, err)
+	if assert.Greater(t, len(chunks), 1) {
+		assert.Contains(t, chunks[0], "[^a]: First footnote")
+		assert.NotContains(t, chunks[0], "[^b]: Second footnote", "references in code are not resolved")
+	}
+	for i, chunk := range chunks {
+		assert.Equal(t, strings.Contains(chunk, "claim[^b]"), strings.Contains(chunk, "[^b]: Second footnote"), "chunk %d", i)
+		assert.LessOrEqual(t, len(chunk), 130, "chunk %d holds the definitions of its footnotes", i)
+	}
+}
+
+func TestReferenceLinks(t *testing.T) {
+	markdownData := []byte("# Guide [Docs]\n\n" +
+		"A reference [link][docs] and an inline [link](https://example.com/inline).\n\n" +
+		"Another paragraph long enough to be chunked apart, with a [shortcut][api].\n\n" +
+		"[docs]: https://example.com/docs \"Docs title\"\n" +
+		"[api]: https://example.com/api\n")
+	chunker := NewMarkdownChunk(180)
+
+	chunks, _, err := chunker.ChunkMarkdown(markdownData)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"# Guide [Docs]\n\nA reference [link][docs] and an inline [link](https://example.com/inline).\n\n" +
+			"[Docs]: https://example.com/docs \"Docs title\"\n\n",
+		"# Guide [Docs]\n\nAnother paragraph long enough to be chunked apart, with a [shortcut][api].\n\n" +
+			"[Docs]: https://example.com/docs \"Docs title\"\n\n[api]: https://example.com/api\n\n",
+	}, chunks)
+}
+
+// countdownContext is a context done after a number of checks, cancelling a conversion half way
+type countdownContext struct {
+	context.Context
+	checks int
+}
+
+func (c *countdownContext) Err() error {
+	if c.checks--; c.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestConvertCancelTable(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("| a | b |\n|---|---|\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, "| %d | %d |\n", i, i)
+	}
+	markdownData := []byte(sb.String())
+
+	// The checks of the parsing are counted, the context is done while the table is chunked
+	parsing := &countdownContext{Context: context.Background(), checks: math.MaxInt}
+	_, err := mdtojson.NewJSONRenderer().Convert(parsing, markdownData)
+	assert.NoError(t, err)
+	checks := math.MaxInt - parsing.checks
+
+	chunker := NewMarkdownChunk(100)
+	ctx := &countdownContext{Context: context.Background(), checks: checks + 10}
+	_, err = chunker.Convert(ctx, markdownData)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestConcurrentChunking(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(t, err)
+	chunker := NewMarkdownChunk(300, WithInlineFootnotes(), WithTransclusion("testdata/wiki"))
+
+	expected := make([][]string, len(files))
+	for i, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		expected[i], _, err = chunker.ChunkMarkdown(markdownData)
+		assert.NoError(t, err)
+	}
+
+	// The documents are chunked concurrently by the shared chunker, several times each
+	actual := make([][]string, 4*len(files))
+	var wg sync.WaitGroup
+	for i := range actual {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			markdownData, err := os.ReadFile(files[i%len(files)])
+			assert.NoError(t, err)
+			actual[i], _, err = chunker.ChunkMarkdown(markdownData)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	for i := range actual {
+		assert.Equal(t, expected[i%len(files)], actual[i], files[i%len(files)])
+	}
+}
+
+func TestLimits(t *testing.T) {
+	// Deeply nested quotes are cut at the default depth, blackfriday stops nesting on its own
+	markdownData := []byte(strings.Repeat("> ", 5000) + "quote\n")
+	chunker := NewDefaultMarkdownChunk(WithParserConfig(mdparser.NewConfig(mdparser.WithBackend(mdparser.BackendGoldmark))))
+	result, err := chunker.Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Warnings, 1) {
+		assert.Equal(t, mdparser.WarningLimit, result.Warnings[0].Kind)
+	}
+
+	var limitError *mdparser.LimitError
+	chunker = NewDefaultMarkdownChunk(WithParserConfig(mdparser.NewConfig(mdparser.WithLimits(mdparser.Limits{MaxInputBytes: 1000}))))
+	_, err = chunker.Convert(context.Background(), markdownData)
+	assert.ErrorAs(t, err, &limitError)
+}
+
+func FuzzChunkMarkdown(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(f, err)
+	for _, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(f, err)
+		f.Add(markdownData, 200)
+	}
+	f.Add([]byte("| |\n|-|\n| a |\n"), 10)
+
+	f.Fuzz(func(t *testing.T, markdownData []byte, chunkSize int) {
+		chunker := NewMarkdownChunk(chunkSize, WithInlineFootnotes(), WithTransclusion("testdata/wiki"))
+		_, _, err := chunker.ChunkMarkdown(markdownData)
+		var internalError *mdparser.InternalError
+		if errors.As(err, &internalError) {
+			t.Fatalf("%v\n%s", err, internalError.Stack)
+		}
+	})
+}
+
+// benchmarkTable returns a markdown table of the given number of rows
+func benchmarkTable(rows int) []byte {
+	var sb strings.Builder
+	sb.WriteString("# Inventory\n\n| ID | Name | Category | Price | Stock |\n|----|------|----------|-------|-------|\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&sb, "| %d | Item %d | Category %d | %d.%02d | %d |\n", i, i, i%17, i%1000, i%100, i%250)
+	}
+	return []byte(sb.String())
+}
+
+// benchmarkWikiPage returns a wiki page of about the given size, mixing the usual blocks
+func benchmarkWikiPage(size int) []byte {
+	var sb strings.Builder
+	for i := 0; sb.Len() < size; i++ {
+		fmt.Fprintf(&sb, "## Section %d\n\n", i)
+		fmt.Fprintf(&sb, "Paragraph %d with *emphasis*, **strong text**, `code` and a [link](https://example.com/%d). ", i, i)
+		sb.WriteString(strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 8) + "\n\n")
+		sb.WriteString("- First item with [[Wiki Page]]\n- Second item\n  - Nested item\n- Third item\n\n")
+		sb.WriteString("> Quoted text spanning\n> two lines.\n\n")
+		sb.WriteString("```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```\n\n")
+		sb.WriteString("| Key | Value |\n|-----|-------|\n| a | 1 |\n| b | 2 |\n\n")
+	}
+	return []byte(sb.String())
+}
+
+func benchmarkChunkMarkdown(b *testing.B, markdownData []byte) {
+	chunker := NewDefaultMarkdownChunk()
+	b.SetBytes(int64(len(markdownData)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := chunker.ChunkMarkdown(markdownData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkChunkJSONMarkdown benchmarks the chunking of the parsed document,
+// failing when a run allocates more than maxAllocs times
+func benchmarkChunkJSONMarkdown(b *testing.B, markdownData []byte, maxAllocs float64) {
+	chunker := NewDefaultMarkdownChunk()
+	nodes, err := mdtojson.NewJSONRenderer().Parse(markdownData)
+	if err != nil {
+		b.Fatal(err)
+	}
+	chunk := func() {
+		chunker.ChunkJSONMarkdown(chunker.CharCount, nodes)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chunk()
+	}
+	b.StopTimer()
+	if allocs := testing.AllocsPerRun(1, chunk); allocs > maxAllocs {
+		b.Errorf("%.0f allocs/op, want at most %.0f", allocs, maxAllocs)
+	}
+}
+
+func BenchmarkChunkMarkdownTable(b *testing.B) {
+	benchmarkChunkMarkdown(b, benchmarkTable(10_000))
+}
+
+func BenchmarkChunkMarkdownWikiPage(b *testing.B) {
+	benchmarkChunkMarkdown(b, benchmarkWikiPage(5<<20))
+}
+
+// The chunks used to be assembled by string concatenation, at 280,000 allocations
+// for the table and 494,000 for the wiki page. The cells of the table rows are encoded
+// one by one into a reused buffer since, at one allocation of encoding/json per cell.
+
+func BenchmarkChunkJSONMarkdownTable(b *testing.B) {
+	benchmarkChunkJSONMarkdown(b, benchmarkTable(10_000), 60_000)
+}
+
+func BenchmarkChunkJSONMarkdownWikiPage(b *testing.B) {
+	benchmarkChunkJSONMarkdown(b, benchmarkWikiPage(5<<20), 220_000)
+}
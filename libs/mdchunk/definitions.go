@@ -0,0 +1,62 @@
+package mdchunk
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdtojson"
+)
+
+// DefinitionListMode defines how definition lists are written into the chunks
+type DefinitionListMode int
+
+const (
+	// DefinitionListModeMarkdown keeps the markdown "Term\n: definition" syntax (default)
+	DefinitionListModeMarkdown DefinitionListMode = iota
+	// DefinitionListModeLines writes one "Term: definition" line per definition
+	DefinitionListModeLines
+)
+
+// definitionPart is a part of a definition list written into the chunks, with the nodes it renders
+type definitionPart struct {
+	text  string
+	nodes []mdtojson.Node
+}
+
+// definitionListParts splits a definition list into the parts written into the chunks,
+// a term with its definitions is never split in markdown mode
+func (mc *MarkdownChunk) definitionListParts(list mdtojson.Node) []definitionPart {
+	parts := []definitionPart{}
+	term := ""
+	var group strings.Builder
+	var nodes []mdtojson.Node // Term and definitions of the group
+	for _, child := range list.GetChildren() {
+		switch node := child.(type) {
+		case *mdtojson.TermNode:
+			if group.Len() > 0 {
+				parts = append(parts, definitionPart{text: group.String() + "\n", nodes: nodes})
+				group.Reset()
+			}
+			term = strings.TrimSpace(node.ToMarkdown())
+			nodes = []mdtojson.Node{node}
+			if mc.DefinitionListMode == DefinitionListModeMarkdown {
+				group.WriteString(node.ToMarkdown())
+			}
+		case *mdtojson.DefinitionNode:
+			if mc.DefinitionListMode == DefinitionListModeLines {
+				text := term + ": " + strings.Join(node.Paragraphs(), " ") + "\n"
+				parts = append(parts, definitionPart{text: text, nodes: append(slices.Clip(nodes), node)})
+				continue
+			}
+			group.WriteString(node.ToMarkdown())
+			nodes = append(nodes, node)
+		}
+	}
+	if group.Len() > 0 {
+		parts = append(parts, definitionPart{text: group.String() + "\n", nodes: nodes})
+	}
+	if mc.DefinitionListMode == DefinitionListModeLines && len(parts) > 0 {
+		parts[len(parts)-1].text += "\n"
+	}
+	return parts
+}
@@ -0,0 +1,29 @@
+package mdchunk
+
+import (
+	"github.com/stencilframe/mdtools/libs/mdtojson"
+)
+
+// DiagramMode defines how diagram sources are written into the chunks
+type DiagramMode int
+
+const (
+	// DiagramModeSource keeps the fenced diagram source (default)
+	DiagramModeSource DiagramMode = iota
+	// DiagramModeSummary replaces the source with the labels and edges of the diagram
+	DiagramModeSummary
+	// DiagramModeExclude removes diagrams from the chunks
+	DiagramModeExclude
+)
+
+// renderDiagram renders the diagram according to the diagram mode
+func (mc *MarkdownChunk) renderDiagram(diagram *mdtojson.DiagramNode) string {
+	switch mc.DiagramMode {
+	case DiagramModeSummary:
+		return diagram.Summary()
+	case DiagramModeExclude:
+		return ""
+	default:
+		return diagram.ToMarkdown()
+	}
+}
@@ -0,0 +1,25 @@
+package mdchunk
+
+import (
+	"math"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdtojson"
+)
+
+// extractFootnotes removes the footnote definitions from the root nodes
+// and registers their rendered definitions by ^label. The chunks append the definitions
+// of the footnotes they reference, counted in their length.
+func (mc *MarkdownChunk) extractFootnotes(nodes []mdtojson.Node, state *chunkState) []mdtojson.Node {
+	content := make([]mdtojson.Node, 0, len(nodes))
+	for _, node := range nodes {
+		footnote, ok := node.(*mdtojson.FootnoteDefNode)
+		if !ok {
+			content = append(content, node)
+			continue
+		}
+		text := mc.chunkJSONMarkdown(math.MaxInt, footnote.GetChildren(), state)
+		state.definitions["^"+footnote.Label] = "[^" + footnote.Label + "]: " + strings.TrimSpace(strings.Join(text, ""))
+	}
+	return content
+}
@@ -0,0 +1,160 @@
+package mdchunk
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	"github.com/stencilframe/mdtools/libs/mdtojson"
+)
+
+// WithTransclusion inlines the ![[Page#Section]] embeds with the section of the page,
+// read from the markdown files of dir. The wiki links are parsed by the renderer.
+func WithTransclusion(dir string) Option {
+	return func(mc *MarkdownChunk) {
+		mc.TransclusionDir = dir
+	}
+}
+
+// WithTransclusionPage names the page of the chunked document in the transclusion directory,
+// so that the embeds of the document cannot transclude the document itself
+func WithTransclusionPage(page string) Option {
+	return func(mc *MarkdownChunk) {
+		mc.TransclusionPage = page
+	}
+}
+
+// WithTransclusionLimit sets the total size in bytes of the pages transcluded into a document,
+// the embeds over the limit are left as is with a warning. 0 sets no limit.
+func WithTransclusionLimit(bytes int) Option {
+	return func(mc *MarkdownChunk) {
+		mc.TransclusionBytes = bytes
+	}
+}
+
+// rendererOptionsList returns the options of the JSON renderer,
+// the wiki links are parsed by default when the embeds are transcluded
+func (mc *MarkdownChunk) rendererOptionsList() []mdtojson.Option {
+	if mc.TransclusionDir == "" {
+		return mc.rendererOptions
+	}
+	return append([]mdtojson.Option{mdtojson.WithWikiLinks(mdtojson.WikiLinks{Extension: ".md"})}, mc.rendererOptions...)
+}
+
+// transclusionRoot returns the stack of the page sections being transcluded when the chunking starts,
+// the whole page of the document when it is known
+func (mc *MarkdownChunk) transclusionRoot() []string {
+	path, ok := mc.transclusionPath(mc.TransclusionPage)
+	if !ok {
+		return nil
+	}
+	return []string{path + "#"}
+}
+
+// transclude fills the embeds of the nodes with the content of the pages they reference.
+// The stack holds the page sections being transcluded, an embed closing a cycle is left as is.
+// The embeds of missing pages or sections, and the embeds over the size limit, are left as is with a warning.
+func (mc *MarkdownChunk) transclude(renderer *mdtojson.JSONRenderer, nodes []mdtojson.Node, stack []string, state *chunkState) {
+	for _, node := range nodes {
+		embed, ok := node.(*mdtojson.EmbedNode)
+		if !ok {
+			mc.transclude(renderer, node.GetChildren(), stack, state)
+			continue
+		}
+
+		state.checkContext()
+		path, ok := mc.transclusionPath(embed.Page)
+		if !ok {
+			continue
+		}
+		key := path + "#" + mdtojson.Slugify(embed.Section)
+		if slices.Contains(stack, key) {
+			continue
+		}
+		markdownData, err := readPage(path)
+		if err != nil {
+			state.warnings = append(state.warnings, mdparser.Warnf(mdparser.WarningTransclusion, "embed %q: %v", embed.Page, err))
+			continue
+		}
+		if mc.TransclusionBytes > 0 && state.transcluded+len(markdownData) > mc.TransclusionBytes {
+			state.warnings = append(state.warnings, mdparser.Warnf(mdparser.WarningLimit, "embed %q: transcluded pages over the limit of %d bytes", embed.Page, mc.TransclusionBytes))
+			continue
+		}
+		state.transcluded += len(markdownData)
+		nodes, err := mdtojson.NewJSONRenderer(mc.rendererOptionsList()...).ParseContext(state.ctx, markdownData)
+		if err != nil {
+			state.checkContext()
+			state.warnings = append(state.warnings, mdparser.Warnf(mdparser.WarningTransclusion, "embed %q: %v", embed.Page, err))
+			continue
+		}
+		content := findSection(nodes, embed.Section)
+		if len(content) == 0 {
+			state.warnings = append(state.warnings, mdparser.Warnf(mdparser.WarningTransclusion, "embed %q: no section %q", embed.Page, embed.Section))
+			continue
+		}
+
+		// The images are numbered with the images of the document
+		registerImages(renderer, content)
+		mc.transclude(renderer, content, append(slices.Clip(stack), key), state)
+		embed.SetChildren(content)
+	}
+}
+
+// transclusionPath returns the markdown file of a page, which must be inside the transclusion directory
+func (mc *MarkdownChunk) transclusionPath(page string) (string, bool) {
+	if page == "" {
+		return "", false
+	}
+	switch strings.ToLower(filepath.Ext(page)) {
+	case "":
+		page += ".md"
+	case ".md", ".markdown":
+	default:
+		// Embedded images and attachments are not transcluded
+		return "", false
+	}
+	return mdparser.LocalPath(mc.TransclusionDir, page)
+}
+
+// readPage reads the markdown file of a page, which must be a regular file
+func readPage(path string) ([]byte, error) {
+	f, err := mdparser.OpenRegular(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// findSection returns the heading matching the section by ID or title, or all the nodes without section
+func findSection(nodes []mdtojson.Node, section string) []mdtojson.Node {
+	if section == "" {
+		return nodes
+	}
+	slug := mdtojson.Slugify(section)
+	for _, node := range nodes {
+		heading, ok := node.(*mdtojson.HeadingNode)
+		if !ok {
+			continue
+		}
+		if heading.ID == slug || strings.EqualFold(heading.Title, section) {
+			return []mdtojson.Node{heading}
+		}
+		if found := findSection(heading.GetChildren(), section); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// registerImages registers the images of the nodes with the renderer of the document
+func registerImages(renderer *mdtojson.JSONRenderer, nodes []mdtojson.Node) {
+	for _, node := range nodes {
+		if image, ok := node.(*mdtojson.ImageNode); ok {
+			renderer.AddImage(image)
+		}
+		registerImages(renderer, node.GetChildren())
+	}
+}
@@ -0,0 +1,234 @@
+// Package mdmath protects the $inline$ and $$display$$ LaTeX math of a
+// markdown document from the inline parsing of blackfriday, which treats
+// the _ and * of the formulas as emphasis.
+//
+// Protect replaces the math with placeholders before parsing; the
+// placeholders are resolved back with Lookup, Split or Restore.
+package mdmath
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+)
+
+// The placeholders are delimited by U+E001, a private use character which
+// mdparser.ReplaceReserved removes from the document text, and hold the index of the span
+const placeholderDelimiter = "\uE001"
+
+// placeholderRe matches the placeholders of the math spans
+var placeholderRe = regexp.MustCompile(placeholderDelimiter + `(\d+)` + placeholderDelimiter)
+
+// Span is a math span of the document
+type Span struct {
+	Math    string // LaTeX source, without the delimiters
+	Display bool   // $$display$$ math
+	Block   bool   // Display math on its own lines
+	Raw     string // Original markdown of the span
+}
+
+// Spans are the math spans of a document, indexed by their placeholder
+type Spans []*Span
+
+// Protect replaces the math of the markdown with placeholders.
+// Display math on its own lines becomes a placeholder paragraph.
+// Math in code blocks and code spans is left untouched.
+// The reserved characters of the markdown are replaced first with mdparser.ReplaceReserved.
+func Protect(markdownData []byte) ([]byte, Spans) {
+	var (
+		output bytes.Buffer
+		spans  Spans
+	)
+
+	lines := mdparser.SplitLines(markdownData)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		text := strings.TrimRight(line.Text, "\r\n")
+
+		// Math syntax is literal inside code blocks
+		if line.Code {
+			output.WriteString(line.Text)
+			continue
+		}
+
+		// Display math blocks open with $$ at the start of a line
+		if trimmed := strings.TrimLeft(text, " "); len(text)-len(trimmed) <= 3 && strings.HasPrefix(trimmed, "$$") {
+			if end, ok := blockEnd(lines, i); ok {
+				raw := ""
+				for _, line := range lines[i : end+1] {
+					raw += line.Text
+				}
+				raw = strings.TrimRight(raw, "\r\n")
+				math := strings.TrimSpace(raw)
+				math = strings.TrimSpace(math[2 : len(math)-2])
+				spans = append(spans, &Span{Math: math, Display: true, Block: true, Raw: raw})
+				output.WriteString("\n" + placeholder(len(spans)-1) + "\n\n")
+				i = end
+				continue
+			}
+		}
+
+		// Code spans are left untouched
+		for part, code := range mdparser.SplitCodeSpans(line.Text) {
+			if code {
+				output.WriteString(part)
+			} else {
+				output.WriteString(protectInline(part, &spans))
+			}
+		}
+	}
+	return output.Bytes(), spans
+}
+
+// blockEnd returns the index of the line closing the display math block opened at start
+func blockEnd(lines []mdparser.Line, start int) (int, bool) {
+	first := strings.TrimSpace(lines[start].Text)
+	if len(first) > 4 && strings.HasSuffix(first, "$$") {
+		// Single line block, such as $$x^2$$
+		return start, !strings.Contains(first[2:len(first)-2], "$$")
+	}
+	if first != "$$" {
+		// Text after the opening $$ is inline display math
+		return 0, false
+	}
+	for i := start + 1; i < len(lines); i++ {
+		text := strings.TrimSpace(lines[i].Text)
+		switch {
+		case text == "" || lines[i].Code:
+			// Blank lines end the paragraph
+			return 0, false
+		case strings.HasSuffix(text, "$$"):
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// protectInline replaces the $inline$ and $$display$$ math of a text without code spans
+func protectInline(line string, spans *Spans) string {
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			// Escaped characters, such as \$
+			sb.WriteString(line[i : i+2])
+			i += 2
+			continue
+		case c == '$':
+			if end, span, ok := inlineSpan(line, i); ok {
+				*spans = append(*spans, span)
+				sb.WriteString(placeholder(len(*spans) - 1))
+				i = end
+				continue
+			}
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return sb.String()
+}
+
+// inlineSpan parses the math span opened at the start index of the line.
+// Following pandoc, the opening $ cannot be followed by a space, and the
+// closing $ cannot be preceded by a space nor followed by a digit.
+func inlineSpan(line string, start int) (int, *Span, bool) {
+	if strings.HasPrefix(line[start:], "$$") {
+		end := strings.Index(line[start+2:], "$$")
+		if end <= 0 {
+			return 0, nil, false
+		}
+		end += start + 2
+		return end + 2, &Span{Math: line[start+2 : end], Display: true, Raw: line[start : end+2]}, true
+	}
+
+	if start+1 >= len(line) || strings.ContainsRune(" \t\r\n$", rune(line[start+1])) {
+		return 0, nil, false
+	}
+	for end := start + 1; end < len(line); end++ {
+		switch line[end] {
+		case '\\':
+			end++
+		case '\n', '`':
+			// Math spans neither cross lines nor contain code spans
+			return 0, nil, false
+		case '$':
+			if strings.ContainsRune(" \t", rune(line[end-1])) {
+				continue
+			}
+			if end+1 < len(line) && line[end+1] >= '0' && line[end+1] <= '9' {
+				continue
+			}
+			return end + 1, &Span{Math: line[start+1 : end], Raw: line[start : end+1]}, true
+		}
+	}
+	return 0, nil, false
+}
+
+// placeholder returns the placeholder of the span at the index
+func placeholder(index int) string {
+	return placeholderDelimiter + strconv.Itoa(index) + placeholderDelimiter
+}
+
+// span returns the span of a placeholder match
+func (s Spans) span(match string) *Span {
+	index, err := strconv.Atoi(strings.Trim(match, placeholderDelimiter))
+	if err != nil || index < 0 || index >= len(s) {
+		return nil
+	}
+	return s[index]
+}
+
+// Lookup returns the span of the text when it is a single placeholder
+func (s Spans) Lookup(text string) (*Span, bool) {
+	text = strings.TrimSpace(text)
+	if !placeholderRe.MatchString(text) || placeholderRe.FindString(text) != text {
+		return nil, false
+	}
+	span := s.span(text)
+	return span, span != nil
+}
+
+// Part is a part of a text, either plain text or a math span
+type Part struct {
+	Text string
+	Span *Span
+}
+
+// Split splits a text into its plain text and math span parts
+func (s Spans) Split(text string) []Part {
+	parts := []Part{}
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringIndex(text, -1) {
+		span := s.span(text[loc[0]:loc[1]])
+		if span == nil {
+			continue
+		}
+		if loc[0] > last {
+			parts = append(parts, Part{Text: text[last:loc[0]]})
+		}
+		parts = append(parts, Part{Span: span})
+		last = loc[1]
+	}
+	if last < len(text) {
+		parts = append(parts, Part{Text: text[last:]})
+	}
+	return parts
+}
+
+// Restore replaces the placeholders of the data with the original math
+func (s Spans) Restore(data []byte) []byte {
+	if len(s) == 0 {
+		return data
+	}
+	return placeholderRe.ReplaceAllFunc(data, func(match []byte) []byte {
+		span := s.span(string(match))
+		if span == nil {
+			return match
+		}
+		return []byte(span.Raw)
+	})
+}
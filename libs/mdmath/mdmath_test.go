@@ -0,0 +1,111 @@
+package mdmath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtect(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected []Span
+	}{
+		{
+			name:     "Inline",
+			markdown: "The sum $a_i * b_i$ of $x$.",
+			expected: []Span{
+				{Math: "a_i * b_i", Raw: "$a_i * b_i$"},
+				{Math: "x", Raw: "$x$"},
+			},
+		},
+		{
+			name:     "InlineDisplay",
+			markdown: "Display $$\\int f$$ math.",
+			expected: []Span{
+				{Math: "\\int f", Display: true, Raw: "$$\\int f$$"},
+			},
+		},
+		{
+			name:     "Block",
+			markdown: "Text\n\n$$\nx_1\n$$\n\nMore text",
+			expected: []Span{
+				{Math: "x_1", Display: true, Block: true, Raw: "$$\nx_1\n$$"},
+			},
+		},
+		{
+			name:     "SingleLineBlock",
+			markdown: "$$x_1$$\n",
+			expected: []Span{
+				{Math: "x_1", Display: true, Block: true, Raw: "$$x_1$$"},
+			},
+		},
+		{
+			name:     "Prices",
+			markdown: "Prices such as $5 and $10, or $ 5 $.",
+			expected: []Span{},
+		},
+		{
+			name:     "Escaped",
+			markdown: "Escaped \\$x$ dollar.",
+			expected: []Span{},
+		},
+		{
+			name:     "Code",
+			markdown: "A `$code_span$` and\n\n```\n$$\nx\n$$\n```\n",
+			expected: []Span{},
+		},
+		{
+			name:     "NestedCode",
+			markdown: "Text\n\n    echo $HOME/$PATH\n\n- Item\n\n  ```sh\n  echo $HOME/$PATH\n  ```\n\n> ~~~\n> $x$\n> ~~~\n",
+			expected: []Span{},
+		},
+		{
+			name:     "UnclosedBlock",
+			markdown: "$$\nx_1\n\nText",
+			expected: []Span{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protected, spans := Protect([]byte(tt.markdown))
+
+			actual := []Span{}
+			for _, span := range spans {
+				actual = append(actual, *span)
+			}
+			assert.Equal(t, tt.expected, actual)
+
+			// The math is restored verbatim, blocks are set apart as paragraphs
+			restored := string(spans.Restore(protected))
+			for _, span := range spans {
+				if span.Block {
+					restored = strings.Replace(restored, "\n"+span.Raw+"\n\n", span.Raw+"\n", 1)
+				}
+			}
+			assert.Equal(t, tt.markdown, restored)
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	protected, spans := Protect([]byte("a $x$ b $$y$$"))
+
+	parts := spans.Split(string(protected))
+	assert.Equal(t, []Part{
+		{Text: "a "},
+		{Span: spans[0]},
+		{Text: " b "},
+		{Span: spans[1]},
+	}, parts)
+	assert.Equal(t, "a $x$ b $$y$$", string(spans.Restore(protected)))
+
+	span, ok := spans.Lookup(placeholder(0))
+	assert.True(t, ok)
+	assert.Equal(t, "x", span.Math)
+	_, ok = spans.Lookup(string(protected))
+	assert.False(t, ok)
+}
@@ -0,0 +1,222 @@
+package mdparser
+
+// NodeType is the type of a node of the syntax tree
+type NodeType int
+
+// The node types follow the blocks and inlines of CommonMark with the GFM tables and
+// strikethrough; footnotes and definition lists are represented by lists
+const (
+	Document NodeType = iota
+	BlockQuote
+	List
+	Item
+	Paragraph
+	Heading
+	HorizontalRule
+	Emph
+	Strong
+	Del
+	Link
+	Image
+	Text
+	HTMLBlock
+	CodeBlock
+	Softbreak
+	Hardbreak
+	Code
+	HTMLSpan
+	Table
+	TableCell
+	TableHead
+	TableBody
+	TableRow
+)
+
+var nodeTypeNames = []string{
+	Document:       "Document",
+	BlockQuote:     "BlockQuote",
+	List:           "List",
+	Item:           "Item",
+	Paragraph:      "Paragraph",
+	Heading:        "Heading",
+	HorizontalRule: "HorizontalRule",
+	Emph:           "Emph",
+	Strong:         "Strong",
+	Del:            "Del",
+	Link:           "Link",
+	Image:          "Image",
+	Text:           "Text",
+	HTMLBlock:      "HTMLBlock",
+	CodeBlock:      "CodeBlock",
+	Softbreak:      "Softbreak",
+	Hardbreak:      "Hardbreak",
+	Code:           "Code",
+	HTMLSpan:       "HTMLSpan",
+	Table:          "Table",
+	TableCell:      "TableCell",
+	TableHead:      "TableHead",
+	TableBody:      "TableBody",
+	TableRow:       "TableRow",
+}
+
+func (t NodeType) String() string {
+	return nodeTypeNames[t]
+}
+
+// ListType contains the flags of the lists and their items
+type ListType int
+
+const (
+	ListTypeOrdered    ListType = 1 << iota // Ordered list
+	ListTypeDefinition                      // Definition list
+	ListTypeTerm                            // Term of a definition list item
+)
+
+// CellAlignment is the alignment of a table column
+type CellAlignment int
+
+const (
+	AlignNone CellAlignment = iota
+	AlignLeft
+	AlignRight
+	AlignCenter
+)
+
+// Node is a node of the parser-neutral syntax tree
+type Node struct {
+	Type       NodeType
+	Parent     *Node
+	FirstChild *Node
+	LastChild  *Node
+	Prev       *Node
+	Next       *Node
+
+	Literal []byte // Text of the leaf nodes: Text, Code, CodeBlock, HTMLBlock and HTMLSpan
+
+	HeadingData   // Heading fields
+	ListData      // List and Item fields
+	CodeBlockData // CodeBlock fields
+	LinkData      // Link and Image fields
+	TableCellData // TableCell fields
+}
+
+// HeadingData holds the fields of the headings
+type HeadingData struct {
+	Level     int    // Level of the heading, from 1 to 6
+	HeadingID string // Explicit {#id} of the heading
+}
+
+// ListData holds the fields of the lists and their items
+type ListData struct {
+	ListFlags       ListType
+	Tight           bool   // The items are not separated by blank lines
+	Start           int    // Number of the first item of an ordered list
+	RefLink         []byte // Label of a footnote, for the items of the footnotes list
+	IsFootnotesList bool   // The list holds the footnote definitions
+}
+
+// CodeBlockData holds the fields of the code blocks
+type CodeBlockData struct {
+	Info []byte // Info string of a fenced code block
+}
+
+// LinkData holds the fields of the links and images
+type LinkData struct {
+	Destination []byte // URL of the link, or label of a footnote reference
+	Title       []byte
+	Reference   string // Label of the reference the link was resolved from
+	NoteID      int    // Number of a footnote reference, 0 for the other links
+}
+
+// TableCellData holds the fields of the table cells
+type TableCellData struct {
+	IsHeader bool
+	Align    CellAlignment
+}
+
+// NewNode creates a node of the given type
+func NewNode(typ NodeType) *Node {
+	return &Node{Type: typ}
+}
+
+// AppendChild appends a child to the node
+func (n *Node) AppendChild(child *Node) {
+	child.Unlink()
+	child.Parent = n
+	if n.LastChild != nil {
+		n.LastChild.Next = child
+		child.Prev = n.LastChild
+	} else {
+		n.FirstChild = child
+	}
+	n.LastChild = child
+}
+
+// Unlink removes the node from its parent
+func (n *Node) Unlink() {
+	if n.Prev != nil {
+		n.Prev.Next = n.Next
+	} else if n.Parent != nil {
+		n.Parent.FirstChild = n.Next
+	}
+	if n.Next != nil {
+		n.Next.Prev = n.Prev
+	} else if n.Parent != nil {
+		n.Parent.LastChild = n.Prev
+	}
+	n.Parent, n.Prev, n.Next = nil, nil, nil
+}
+
+// IsContainer checks if the node can have children
+func (n *Node) IsContainer() bool {
+	switch n.Type {
+	case Document, BlockQuote, List, Item, Paragraph, Heading, Emph, Strong, Del, Link, Image,
+		Table, TableHead, TableBody, TableRow, TableCell:
+		return true
+	}
+	return false
+}
+
+// WalkStatus tells the walker how to continue after visiting a node
+type WalkStatus int
+
+const (
+	GoToNext     WalkStatus = iota // Continue with the next node
+	SkipChildren                   // Skip the children and the exit of the node
+	Terminate                      // Stop walking
+)
+
+// NodeVisitor is called when entering and exiting the nodes.
+// The leaf nodes are only entered.
+type NodeVisitor func(node *Node, entering bool) WalkStatus
+
+// Walk walks the node and its descendants in document order
+func (n *Node) Walk(visitor NodeVisitor) {
+	current, entering := n, true
+	for current != nil {
+		switch visitor(current, entering) {
+		case Terminate:
+			return
+		case SkipChildren:
+			entering = false
+		}
+		current, entering = n.next(current, entering)
+	}
+}
+
+// next returns the node following the current node of a walk from the root node
+func (n *Node) next(current *Node, entering bool) (*Node, bool) {
+	container := current.IsContainer()
+	switch {
+	case current == n && (!entering || !container):
+		return nil, false
+	case entering && container && current.FirstChild != nil:
+		return current.FirstChild, true
+	case entering && container:
+		return current, false
+	case current.Next != nil:
+		return current.Next, true
+	default:
+		return current.Parent, false
+	}
+}
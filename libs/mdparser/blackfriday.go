@@ -0,0 +1,214 @@
+package mdparser
+
+import (
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// referenceMarker delimits the reference label stored in the link title.
+// Blackfriday does not tell reference links apart from inline links, so
+// the label is carried through the title of the resolved reference.
+const referenceMarker = "\x00"
+
+// blackfridayParser parses the markdown with blackfriday
+type blackfridayParser struct {
+	config *Config
+	budget *NodeBudget // Budget of the converted nodes, nil for no limit
+}
+
+// blackfridayTypes maps the blackfriday node types to the syntax tree node types
+var blackfridayTypes = map[blackfriday.NodeType]NodeType{
+	blackfriday.Document:       Document,
+	blackfriday.BlockQuote:     BlockQuote,
+	blackfriday.List:           List,
+	blackfriday.Item:           Item,
+	blackfriday.Paragraph:      Paragraph,
+	blackfriday.Heading:        Heading,
+	blackfriday.HorizontalRule: HorizontalRule,
+	blackfriday.Emph:           Emph,
+	blackfriday.Strong:         Strong,
+	blackfriday.Del:            Del,
+	blackfriday.Link:           Link,
+	blackfriday.Image:          Image,
+	blackfriday.Text:           Text,
+	blackfriday.HTMLBlock:      HTMLBlock,
+	blackfriday.CodeBlock:      CodeBlock,
+	blackfriday.Softbreak:      Softbreak,
+	blackfriday.Hardbreak:      Hardbreak,
+	blackfriday.Code:           Code,
+	blackfriday.HTMLSpan:       HTMLSpan,
+	blackfriday.Table:          Table,
+	blackfriday.TableCell:      TableCell,
+	blackfriday.TableHead:      TableHead,
+	blackfriday.TableBody:      TableBody,
+	blackfriday.TableRow:       TableRow,
+}
+
+// Parse parses the markdown data with blackfriday and converts the syntax tree
+func (p *blackfridayParser) Parse(markdownData []byte, references []Reference) *Node {
+	override := referenceOverride(append(references, ExtractReferences(markdownData)...))
+	document := p.convert(p.config.ParseBlackfriday(markdownData, blackfriday.WithRefOverride(override)))
+	normalizeFootnotes(document)
+	return document
+}
+
+// referenceOverride resolves the reference definitions, marking the resolved links with their reference label
+func referenceOverride(references []Reference) blackfriday.ReferenceOverrideFunc {
+	definitions := map[string]blackfriday.Reference{}
+	for _, reference := range references {
+		label := strings.ToLower(reference.Label)
+		if _, ok := definitions[label]; ok {
+			// The first definition wins
+			continue
+		}
+		definitions[label] = blackfriday.Reference{Link: reference.Destination, Title: reference.Title}
+	}
+
+	return func(label string) (*blackfriday.Reference, bool) {
+		definition, ok := definitions[strings.ToLower(label)]
+		if !ok {
+			// Let blackfriday resolve the definitions we could not find
+			return nil, false
+		}
+		definition.Title = referenceMarker + label + referenceMarker + definition.Title
+		return &definition, true
+	}
+}
+
+// convert converts a blackfriday node and its children
+func (p *blackfridayParser) convert(n *blackfriday.Node) *Node {
+	p.budget.add()
+	node := &Node{
+		Type:    blackfridayTypes[n.Type],
+		Literal: n.Literal,
+		HeadingData: HeadingData{
+			Level:     n.Level,
+			HeadingID: n.HeadingID,
+		},
+		ListData: ListData{
+			Tight:           n.Tight,
+			RefLink:         n.RefLink,
+			IsFootnotesList: n.IsFootnotesList,
+		},
+		CodeBlockData: CodeBlockData{Info: n.Info},
+		LinkData: LinkData{
+			Destination: n.Destination,
+			Title:       n.Title,
+			NoteID:      n.NoteID,
+		},
+		TableCellData: TableCellData{IsHeader: n.IsHeader},
+	}
+
+	if n.ListFlags&blackfriday.ListTypeOrdered != 0 {
+		node.ListFlags |= ListTypeOrdered
+	}
+	if n.ListFlags&blackfriday.ListTypeDefinition != 0 {
+		node.ListFlags |= ListTypeDefinition
+	}
+	if n.ListFlags&blackfriday.ListTypeTerm != 0 {
+		node.ListFlags |= ListTypeTerm
+	}
+
+	switch {
+	case n.Align&blackfriday.TableAlignmentCenter == blackfriday.TableAlignmentCenter:
+		node.Align = AlignCenter
+	case n.Align&blackfriday.TableAlignmentLeft != 0:
+		node.Align = AlignLeft
+	case n.Align&blackfriday.TableAlignmentRight != 0:
+		node.Align = AlignRight
+	}
+
+	if title := string(n.Title); strings.HasPrefix(title, referenceMarker) {
+		label, linkTitle, _ := strings.Cut(title[len(referenceMarker):], referenceMarker)
+		node.Reference = label
+		node.Title = []byte(linkTitle)
+	}
+
+	for child := n.FirstChild; child != nil; child = child.Next {
+		// Blackfriday leaves empty texts after the inlines
+		if child.Type != blackfriday.Text || len(child.Literal) > 0 {
+			node.AppendChild(p.convert(child))
+		}
+	}
+	return node
+}
+
+// wrapInlines wraps the inlines of a footnote item in paragraphs, like the other list items
+func wrapInlines(item *Node) {
+	children := []*Node{}
+	for n := item.FirstChild; n != nil; n = n.Next {
+		children = append(children, n)
+	}
+
+	var paragraph *Node
+	for _, n := range children {
+		n.Unlink()
+		if !isInline(n.Type) {
+			paragraph = nil
+			item.AppendChild(n)
+			continue
+		}
+		if paragraph == nil {
+			paragraph = NewNode(Paragraph)
+			item.AppendChild(paragraph)
+		}
+		paragraph.AppendChild(n)
+	}
+}
+
+// isInline checks if the node type is an inline
+func isInline(typ NodeType) bool {
+	switch typ {
+	case Emph, Strong, Del, Link, Image, Text, Softbreak, Hardbreak, Code, HTMLSpan:
+		return true
+	}
+	return false
+}
+
+// normalizeFootnotes removes the copies of the footnote content and wraps the footnote inlines
+// TODO: this is a bug in the Blackfriday library, which parses the content
+// of a footnote once per reference. Remove this when fixed
+func normalizeFootnotes(document *Node) {
+	refs := map[string]int{}
+	document.Walk(func(node *Node, entering bool) WalkStatus {
+		switch {
+		case node.Type == List && node.IsFootnotesList:
+			return SkipChildren
+		case entering && node.Type == Link && node.NoteID != 0:
+			refs[string(node.Destination)]++
+		}
+		return GoToNext
+	})
+
+	for list := document.FirstChild; list != nil; list = list.Next {
+		if list.Type != List || !list.IsFootnotesList {
+			continue
+		}
+		for item := list.FirstChild; item != nil; item = item.Next {
+			dropRepeatedFootnoteContent(item, refs[string(item.RefLink)])
+			wrapInlines(item)
+		}
+	}
+}
+
+// dropRepeatedFootnoteContent keeps the first copy of the content of a footnote referenced refs times
+func dropRepeatedFootnoteContent(item *Node, refs int) {
+	count := 0
+	for n := item.FirstChild; n != nil; n = n.Next {
+		count++
+	}
+	if refs < 2 || count%refs != 0 {
+		return
+	}
+
+	n := item.FirstChild
+	for i := 0; i < count/refs; i++ {
+		n = n.Next
+	}
+	for n != nil {
+		next := n.Next
+		n.Unlink()
+		n = next
+	}
+}
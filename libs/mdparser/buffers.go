@@ -0,0 +1,31 @@
+package mdparser
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is left to the garbage collector,
+// so that the pool does not keep the memory of a large document
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers reused by the conversions of all the goroutines
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// GetBuffer returns an empty buffer from the pool, it is returned to the pool with PutBuffer
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer resets the buffer and returns it to the pool, it must not be used afterwards
+func PutBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,228 @@
+// Package mdparser holds the parser configuration shared by the JSON renderer,
+// the chunker, the markdown renderer and the command line tools, so that the
+// same markdown is parsed the same way by every entry point. The documents are
+// parsed into a parser-neutral syntax tree by a blackfriday or goldmark backend.
+//
+// The configurations of NewConfig and RegisterFlags enforce the DefaultLimits unless told otherwise:
+// the documents over the input size or the node count are rejected, and the content past the
+// nesting depth, the table rows and columns and the data URI size is dropped with a warning.
+// WithLimits(Limits{}), or the -max-* flags set to 0, convert the documents without limits.
+package mdparser
+
+import (
+	"bytes"
+	"flag"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// DefaultExtensions are the blackfriday extensions used to parse the markdown.
+// Heading IDs are generated by the JSON renderer, blackfriday only parses explicit {#id} anchors
+const DefaultExtensions = blackfriday.CommonExtensions | blackfriday.Tables | blackfriday.Footnotes
+
+// Config is the configuration of the markdown parser
+type Config struct {
+	Backend         string                 // Parser backend, blackfriday by default
+	Extensions      blackfriday.Extensions // Blackfriday extensions, also selecting the goldmark extensions
+	Emoji           bool                   // Expand the :shortcode: emoji
+	Abbreviations   bool                   // Parse the *[HTML]: HyperText Markup Language definitions
+	SmartTypography bool                   // Convert the straight quotes, dashes and ellipses
+	Math            bool                   // Protect the $inline$ and $$display$$ math from the inline parsing
+	Limits          Limits                 // Resource limits for untrusted documents, DefaultLimits by default
+}
+
+// Option defines the functional option type
+type Option func(c *Config)
+
+// WithBackend sets the parser backend, BackendBlackfriday or BackendGoldmark
+func WithBackend(backend string) Option {
+	return func(c *Config) {
+		c.Backend = backend
+	}
+}
+
+// WithExtensions sets the blackfriday extensions
+func WithExtensions(extensions blackfriday.Extensions) Option {
+	return func(c *Config) {
+		c.Extensions = extensions
+	}
+}
+
+// WithEmoji expands the :shortcode: emoji, such as :smile:
+func WithEmoji() Option {
+	return func(c *Config) {
+		c.Emoji = true
+	}
+}
+
+// WithAbbreviations parses the *[ABBR]: definitions and marks the abbreviations in the text
+func WithAbbreviations() Option {
+	return func(c *Config) {
+		c.Abbreviations = true
+	}
+}
+
+// WithSmartTypography converts the straight quotes to curly quotes, -- and --- to dashes and ... to an ellipsis
+func WithSmartTypography() Option {
+	return func(c *Config) {
+		c.SmartTypography = true
+	}
+}
+
+// WithMath parses the $inline$ and $$display$$ LaTeX math, whose _ and * are not emphasis
+func WithMath() Option {
+	return func(c *Config) {
+		c.Math = true
+	}
+}
+
+// WithLimits sets the resource limits, a zero limit is not enforced
+func WithLimits(limits Limits) Option {
+	return func(c *Config) {
+		c.Limits = limits
+	}
+}
+
+// NewConfig creates a new parser configuration with the default extensions and limits.
+// The DefaultLimits apply unless WithLimits is given: the documents over the input size or
+// the node count are rejected, and the deep nodes, the long tables and the large data URI
+// images are dropped with a warning. WithLimits(Limits{}) converts the documents without limits.
+func NewConfig(options ...Option) *Config {
+	c := &Config{
+		Backend:    BackendBlackfriday,
+		Extensions: DefaultExtensions,
+		Limits:     DefaultLimits,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// RegisterFlags registers the command line flags of the options,
+// the returned configuration is filled once the flags are parsed
+func RegisterFlags(fs *flag.FlagSet) *Config {
+	c := NewConfig()
+	fs.StringVar(&c.Backend, "parser", BackendBlackfriday, "markdown parser backend: blackfriday or goldmark, the markdown renderer only supports blackfriday")
+	fs.BoolVar(&c.Emoji, "emoji", false, "expand the :shortcode: emoji")
+	fs.BoolVar(&c.Abbreviations, "abbreviations", false, "parse the *[ABBR]: abbreviation definitions")
+	fs.BoolVar(&c.SmartTypography, "smart", false, "convert quotes, dashes and ellipses")
+	fs.BoolVar(&c.Math, "math", false, "parse the $inline$ and $$display$$ math")
+	fs.IntVar(&c.Limits.MaxInputBytes, "max-input-bytes", DefaultLimits.MaxInputBytes, "maximum size of the markdown file, 0 for no limit")
+	fs.IntVar(&c.Limits.MaxNodes, "max-nodes", DefaultLimits.MaxNodes, "maximum number of nodes of the syntax tree, 0 for no limit")
+	fs.IntVar(&c.Limits.MaxDepth, "max-depth", DefaultLimits.MaxDepth, "maximum nesting depth of the syntax tree, 0 for no limit")
+	fs.IntVar(&c.Limits.MaxTableRows, "max-table-rows", DefaultLimits.MaxTableRows, "maximum number of body rows of a table, the next rows are dropped, 0 for no limit")
+	fs.IntVar(&c.Limits.MaxTableColumns, "max-table-columns", DefaultLimits.MaxTableColumns, "maximum number of columns of a table, the next columns are dropped, 0 for no limit")
+	fs.IntVar(&c.Limits.MaxDataURIBytes, "max-data-uri-bytes", DefaultLimits.MaxDataURIBytes, "maximum size of a data URI image, the larger images are dropped, 0 for no limit")
+	return c
+}
+
+// ParseBlackfriday parses the markdown data with blackfriday and the configured extensions,
+// for the renderers working on the blackfriday syntax tree. The Backend is not used.
+func (c *Config) ParseBlackfriday(markdownData []byte, options ...blackfriday.Option) *blackfriday.Node {
+	// Blackfriday reads past the end of the definition lists of the data not ending with a newline
+	if !bytes.HasSuffix(markdownData, []byte("\n")) {
+		markdownData = append(markdownData[:len(markdownData):len(markdownData)], '\n')
+	}
+	options = append([]blackfriday.Option{blackfriday.WithExtensions(c.Extensions)}, options...)
+	return blackfriday.New(options...).Parse(markdownData)
+}
+
+// Preprocess prepares the markdown data for parsing,
+// removing the abbreviation definitions when enabled
+func (c *Config) Preprocess(markdownData []byte) ([]byte, *Abbreviations) {
+	if !c.Abbreviations {
+		return markdownData, nil
+	}
+	return ExtractAbbreviations(markdownData)
+}
+
+// Text applies the emoji and typography options to a literal text
+func (c *Config) Text(text string) string {
+	text, _ = c.text(text, ' ')
+	return text
+}
+
+// text applies the options to a literal text following the previous character
+func (c *Config) text(text string, previous rune) (string, rune) {
+	if c.Emoji {
+		text = Emojize(text)
+	}
+	if c.SmartTypography {
+		text = Smarten(text, previous)
+	}
+	if text != "" {
+		previous = lastRune(text)
+	}
+	return text, previous
+}
+
+// Transform applies the emoji and typography options to the text nodes of a parsed document.
+// Code, autolinks and HTML are left untouched.
+func (c *Config) Transform(document *Node) {
+	if !c.Emoji && !c.SmartTypography {
+		return
+	}
+
+	// The quotes are told apart following the text of the block
+	previous := ' '
+	document.Walk(func(node *Node, entering bool) WalkStatus {
+		switch {
+		case !entering:
+		case node.IsContainer() && node.Type != Link && node.Type != Emph && node.Type != Strong && node.Type != Del:
+			previous = ' '
+		case node.Type == Text:
+			if isAutolink(node) {
+				break
+			}
+			var text string
+			text, previous = c.text(string(node.Literal), previous)
+			node.Literal = []byte(text)
+		case len(node.Literal) > 0:
+			previous = lastRune(string(node.Literal))
+		}
+		return GoToNext
+	})
+}
+
+// TransformBlackfriday applies the emoji and typography options to a document parsed by blackfriday
+func (c *Config) TransformBlackfriday(document *blackfriday.Node) {
+	if !c.Emoji && !c.SmartTypography {
+		return
+	}
+
+	previous := ' '
+	document.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		switch {
+		case !entering:
+		case node.IsContainer() && node.Type != blackfriday.Link && node.Type != blackfriday.Emph &&
+			node.Type != blackfriday.Strong && node.Type != blackfriday.Del:
+			previous = ' '
+		case node.Type == blackfriday.Text:
+			if node.Parent != nil && node.Parent.Type == blackfriday.Link &&
+				isAutolinkText(string(node.Literal), string(node.Parent.LinkData.Destination)) {
+				break
+			}
+			var text string
+			text, previous = c.text(string(node.Literal), previous)
+			node.Literal = []byte(text)
+		case len(node.Literal) > 0:
+			previous = lastRune(string(node.Literal))
+		}
+		return blackfriday.GoToNext
+	})
+}
+
+// isAutolink checks if the text node is the text of an autolink, which is the link destination
+func isAutolink(node *Node) bool {
+	parent := node.Parent
+	if parent == nil || parent.Type != Link {
+		return false
+	}
+	return isAutolinkText(string(node.Literal), string(parent.LinkData.Destination))
+}
+
+// isAutolinkText checks if a link text is the destination of the link
+func isAutolinkText(text, destination string) bool {
+	return text == destination || "mailto:"+text == destination
+}
@@ -0,0 +1,297 @@
+package mdparser
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmarten(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "Double quotes", text: `He said "hello" (and "bye")`, expected: "He said “hello” (and “bye”)"},
+		{name: "Single quotes", text: `'quoted' and it's`, expected: "‘quoted’ and it’s"},
+		{name: "Dashes", text: "pages 1--2 --- or more", expected: "pages 1–2 — or more"},
+		{name: "Ellipsis", text: "wait...", expected: "wait…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Smarten(tt.text, ' '))
+		})
+	}
+}
+
+func TestEmojize(t *testing.T) {
+	assert.Equal(t, "Ship it 🚀 👍", Emojize("Ship it :rocket: :+1:"))
+	assert.Equal(t, "Unknown :not_an_emoji: and 10:30:45", Emojize("Unknown :not_an_emoji: and 10:30:45"))
+}
+
+func TestExtractAbbreviations(t *testing.T) {
+	markdownData := []byte("The HTML spec.\n*[HTML]: HyperText Markup Language\n*[HTML]: Ignored\n\n```\n*[CSS]: Code\n```\n")
+	markdownData, abbreviations := ExtractAbbreviations(markdownData)
+
+	assert.Equal(t, "The HTML spec.\n\n\n\n```\n*[CSS]: Code\n```\n", string(markdownData))
+	assert.Equal(t, []Abbreviation{{Abbr: "HTML", Title: "HyperText Markup Language"}}, abbreviations.Definitions)
+	assert.Equal(t, []Part{
+		{Text: "An "},
+		{Abbreviation: &Abbreviation{Abbr: "HTML", Title: "HyperText Markup Language"}},
+		{Text: " page, not XHTML"},
+	}, abbreviations.Split("An HTML page, not XHTML"))
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		code     []bool
+	}{
+		{name: "Fenced", markdown: "Text\n```go\ncode\n```\nText", code: []bool{false, true, true, true, false}},
+		{name: "LongerFence", markdown: "````\n```\n````\nText", code: []bool{true, true, true, false}},
+		{name: "Indented", markdown: "Text\n\n    code\n\tcode\nText", code: []bool{false, false, true, true, false}},
+		{name: "ParagraphContinuation", markdown: "Text\n    more text", code: []bool{false, false}},
+		{name: "ListItem", markdown: "- Item\n\n      code\n\n  Text", code: []bool{false, false, true, false, false}},
+		{name: "ListItemFence", markdown: "1. Item\n   ```\n   code\n   ```\n   Text", code: []bool{false, true, true, true, false}},
+		{name: "FenceInItem", markdown: "- ```\n  code\n  ```", code: []bool{true, true, true}},
+		{name: "ItemClosesFence", markdown: "- Item\n\n  ```\n  code\nText", code: []bool{false, false, true, true, false}},
+		{name: "BlockQuote", markdown: "> Text\n>\n>     code\n> ```\n> code\n> ```", code: []bool{false, false, true, true, true, true}},
+		{name: "QuoteClosesFence", markdown: "> ```\n> code\n\nText", code: []bool{true, true, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := []bool{}
+			for _, line := range SplitLines([]byte(tt.markdown)) {
+				code = append(code, line.Code)
+			}
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestReplaceReserved(t *testing.T) {
+	markdownData, replaced := ReplaceReserved([]byte("a \uE000b\uE001 c\uE002\uE003"))
+	assert.Equal(t, "a \uFFFDb\uFFFD c\uFFFD\uE003", string(markdownData))
+	assert.Equal(t, 3, replaced)
+
+	markdownData = []byte("text")
+	replacedData, replaced := ReplaceReserved(markdownData)
+	assert.Equal(t, markdownData, replacedData)
+	assert.Zero(t, replaced)
+}
+
+func TestSplitCodeSpans(t *testing.T) {
+	parts := []string{}
+	for part, code := range SplitCodeSpans("a `b` \\`c ``d`e`` f `g") {
+		parts = append(parts, fmt.Sprintf("%s:%t", part, code))
+	}
+	assert.Equal(t, []string{"a :false", "`b`:true", " \\`c :false", "``d`e``:true", " f `g:false"}, parts)
+}
+
+func TestTransform(t *testing.T) {
+	config := NewConfig(WithEmoji(), WithSmartTypography())
+	document := config.Parser().Parse([]byte(`*"Quoted"* text :tada: with `+"`\"code\"`"+` and <https://example.com/a--b>`), nil)
+	config.Transform(document)
+
+	texts := []string{}
+	document.Walk(func(node *Node, entering bool) WalkStatus {
+		if entering && len(node.Literal) > 0 {
+			texts = append(texts, string(node.Literal))
+		}
+		return GoToNext
+	})
+	assert.Equal(t, []string{"“Quoted”", " text 🎉 with ", `"code"`, " and ", "https://example.com/a--b"}, texts)
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	config := RegisterFlags(fs)
+	assert.NoError(t, fs.Parse([]string{"-emoji", "-smart", "-parser", "goldmark", "-max-depth", "10", "-max-table-rows", "0", "-max-data-uri-bytes", "1024", "file.md"}))
+	limits := DefaultLimits
+	limits.MaxDepth = 10
+	limits.MaxTableRows = 0
+	limits.MaxDataURIBytes = 1024
+	assert.Equal(t, &Config{Backend: BackendGoldmark, Extensions: DefaultExtensions, Emoji: true, SmartTypography: true, Limits: limits}, config)
+}
+
+func TestRecover(t *testing.T) {
+	convert := func(f func()) (err error) {
+		defer Recover(&err)
+		f()
+		return nil
+	}
+
+	assert.NoError(t, convert(func() {}))
+	assert.ErrorIs(t, convert(func() { Abort(context.Canceled) }), context.Canceled)
+	var internalError *InternalError
+	if assert.ErrorAs(t, convert(func() { panic("index out of range") }), &internalError) {
+		assert.Equal(t, "markdown: internal error: index out of range", internalError.Error())
+		assert.NotEmpty(t, internalError.Stack)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxInputBytes: 10, MaxNodes: 5, MaxDepth: 3}
+	assert.NoError(t, limits.CheckInput([]byte("0123456789")))
+	assert.EqualError(t, limits.CheckInput([]byte("0123456789\n")), "markdown: 11 input bytes exceed the limit of 10")
+	assert.NoError(t, limits.CheckNodes(5))
+	var limitError *LimitError
+	if assert.ErrorAs(t, limits.CheckNodes(6), &limitError) {
+		assert.Equal(t, &LimitError{Limit: "nodes", Value: 6, Max: 5}, limitError)
+	}
+	assert.NoError(t, Limits{}.CheckInput(make([]byte, 1<<20)))
+
+	// Document > BlockQuote > BlockQuote > Paragraph > Emph > Text, the emphasis is dropped at depth 4
+	markdownData := []byte("> > *quote*\n\nText\n")
+	for _, backend := range []string{BackendBlackfriday, BackendGoldmark} {
+		t.Run(backend, func(t *testing.T) {
+			document := NewConfig(WithBackend(backend)).Parser().Parse(markdownData, nil)
+			assert.Equal(t, 8, CountNodes(document))
+			assert.Equal(t, 2, limits.TruncateDepth(document, 0))
+			assert.Equal(t, []string{
+				"Document",
+				" BlockQuote",
+				"  BlockQuote",
+				"   Paragraph",
+				" Paragraph",
+				"  Text Text",
+			}, dumpNodes(document))
+			assert.Equal(t, 0, Limits{}.TruncateDepth(document, 0))
+		})
+	}
+
+	// Blackfriday keeps an empty text before the emphasis
+	document := NewConfig().ParseBlackfriday(markdownData)
+	count, removed := limits.TruncateDepthBlackfriday(document)
+	assert.Equal(t, 9, count)
+	assert.Equal(t, 3, removed)
+}
+
+func TestParserBackends(t *testing.T) {
+	markdownData := []byte("# Title {#intro}\n\n" +
+		"Some *emphasis*, **strong** and ~~deleted~~ text with `code`,\n" +
+		"a [link](https://example.com \"Example\"), a [reference][ref] and <https://example.com/auto>.\n\n" +
+		"- [x] Done\n- Item with a note[^1]\n\n" +
+		"| Name | Value |\n|:-----|------:|\n| a    | 1     |\n\n" +
+		"```go\nfmt.Println()\n```\n\n" +
+		"[ref]: https://example.com/ref\n\n" +
+		"[^1]: The note.\n")
+
+	for _, backend := range []string{BackendBlackfriday, BackendGoldmark} {
+		t.Run(backend, func(t *testing.T) {
+			document := NewConfig(WithBackend(backend)).Parser().Parse(markdownData, nil)
+			assert.Equal(t, []string{
+				"Document",
+				" Heading 1 #intro",
+				"  Text Title",
+				" Paragraph",
+				"  Text Some ",
+				"  Emph",
+				"   Text emphasis",
+				"  Text , ",
+				"  Strong",
+				"   Text strong",
+				"  Text  and ",
+				"  Del",
+				"   Text deleted",
+				"  Text  text with ",
+				"  Code code",
+				"  Text ,\na ",
+				"  Link https://example.com \"Example\"",
+				"   Text link",
+				"  Text , a ",
+				"  Link https://example.com/ref [ref]",
+				"   Text reference",
+				"  Text  and ",
+				"  Link https://example.com/auto",
+				"   Text https://example.com/auto",
+				"  Text .",
+				" List",
+				"  Item",
+				"   Paragraph",
+				"    Text [x] Done",
+				"  Item",
+				"   Paragraph",
+				"    Text Item with a note",
+				"    Link 1 ^1",
+				" Table",
+				"  TableHead",
+				"   TableRow",
+				"    TableCell header",
+				"     Text Name",
+				"    TableCell header",
+				"     Text Value",
+				"  TableBody",
+				"   TableRow",
+				"    TableCell",
+				"     Text a",
+				"    TableCell",
+				"     Text 1",
+				" CodeBlock go fmt.Println()\n",
+				" List footnotes",
+				"  Item 1",
+				"   Paragraph",
+				"    Text The note.",
+			}, dumpNodes(document))
+		})
+	}
+}
+
+// dumpNodes describes the nodes of a syntax tree, one per line indented by depth
+func dumpNodes(document *Node) []string {
+	lines := []string{}
+	depth := 0
+	document.Walk(func(node *Node, entering bool) WalkStatus {
+		if !entering {
+			depth--
+			return GoToNext
+		}
+		line := strings.Repeat(" ", depth) + node.Type.String()
+		switch node.Type {
+		case Heading:
+			line += fmt.Sprintf(" %d #%s", node.Level, node.HeadingID)
+		case Link:
+			if node.NoteID != 0 {
+				line += " " + strconv.Itoa(node.NoteID) + " ^" + string(node.Destination)
+				break
+			}
+			line += " " + string(node.Destination)
+			if len(node.Title) > 0 {
+				line += fmt.Sprintf(" %q", node.Title)
+			}
+			if node.Reference != "" {
+				line += " [" + node.Reference + "]"
+			}
+		case TableCell:
+			if node.IsHeader {
+				line += " header"
+			}
+		case List:
+			if node.IsFootnotesList {
+				line += " footnotes"
+			}
+		case Item:
+			if len(node.RefLink) > 0 {
+				line += " " + string(node.RefLink)
+			}
+		case CodeBlock:
+			line += " " + string(node.Info) + " " + string(node.Literal)
+		case Text, Code:
+			line += " " + string(node.Literal)
+		}
+		lines = append(lines, line)
+		if node.IsContainer() {
+			depth++
+		}
+		return GoToNext
+	})
+	return lines
+}
@@ -0,0 +1,74 @@
+package mdparser
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// InternalError is returned instead of a panic when the conversion of a document fails
+// unexpectedly, so that untrusted documents cannot crash the process
+type InternalError struct {
+	Value any    // Value of the recovered panic
+	Stack []byte // Stack trace of the panic
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("markdown: internal error: %v", e.Value)
+}
+
+// Recover turns a panic of the entry points into an InternalError, it must be deferred:
+//
+//	defer mdparser.Recover(&err)
+//
+// The error of an Abort is returned as is.
+func Recover(err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if abort, ok := p.(abortError); ok {
+		*err = abort.err
+		return
+	}
+	*err = &InternalError{Value: p, Stack: debug.Stack()}
+}
+
+// abortError is the panic value of Abort
+type abortError struct {
+	err error
+}
+
+// Abort stops a conversion from deep in the syntax tree, such as when a limit is exceeded or the context
+// is done. The error is returned by the entry point recovering with Recover.
+func Abort(err error) {
+	panic(abortError{err: err})
+}
+
+// WarningKind tells what a warning is about
+type WarningKind string
+
+const (
+	WarningAnchor       WarningKind = "anchor"       // In-document link to a missing heading
+	WarningImage        WarningKind = "image"        // Image not extracted or resolved
+	WarningContainer    WarningKind = "container"    // Container block with an invalid body
+	WarningTransclusion WarningKind = "transclusion" // Embed whose page cannot be transcluded
+	WarningNode         WarningKind = "node"         // Node the converter does not handle, left out of the output
+	WarningLimit        WarningKind = "limit"        // Content dropped by a limit of the configuration
+	WarningInput        WarningKind = "input"        // Characters of the input replaced before parsing
+	WarningBackend      WarningKind = "backend"      // Parser backend not supported, blackfriday used instead
+)
+
+// Warning is a non-fatal problem found during a conversion, the output is still usable
+type Warning struct {
+	Kind    WarningKind
+	Message string
+}
+
+// Warnf returns a warning of the kind with a formatted message
+func Warnf(kind WarningKind, format string, args ...any) Warning {
+	return Warning{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+func (w Warning) String() string {
+	return string(w.Kind) + ": " + w.Message
+}
@@ -0,0 +1,306 @@
+package mdparser
+
+import (
+	"bytes"
+
+	"github.com/russross/blackfriday/v2"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// goldmarkParser parses the markdown with goldmark, following CommonMark and GFM.
+// The blackfriday extensions of the configuration select the matching goldmark extensions.
+type goldmarkParser struct {
+	config *Config
+	budget *NodeBudget // Budget of the converted nodes, nil for no limit
+}
+
+// Parse parses the markdown data with goldmark and converts the syntax tree
+func (p *goldmarkParser) Parse(markdownData []byte, references []Reference) *Node {
+	ctx := parser.NewContext()
+	for _, reference := range references {
+		ctx.AddReference(parser.NewReference([]byte(reference.Label), []byte(reference.Destination), []byte(reference.Title)))
+	}
+	document := p.markdown().Parser().Parse(text.NewReader(markdownData), parser.WithContext(ctx))
+
+	c := &goldmarkConverter{source: markdownData, footnotes: map[int][]byte{}, budget: p.budget}
+	_ = ast.Walk(document, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if footnote, ok := n.(*east.Footnote); ok && entering {
+			c.footnotes[footnote.Index] = footnote.Ref
+		}
+		return ast.WalkContinue, nil
+	})
+	return c.convert(document)
+}
+
+// goldmarkExtensions are the goldmark extensions matching the blackfriday extensions
+var goldmarkExtensions = []struct {
+	flag     blackfriday.Extensions
+	extender goldmark.Extender
+}{
+	{flag: blackfriday.Tables, extender: extension.Table},
+	{flag: blackfriday.Strikethrough, extender: extension.Strikethrough},
+	{flag: blackfriday.Autolink, extender: extension.Linkify},
+	{flag: blackfriday.Footnotes, extender: extension.Footnote},
+	{flag: blackfriday.DefinitionLists, extender: extension.DefinitionList},
+}
+
+// markdown creates the goldmark markdown with the extensions of the configuration
+func (p *goldmarkParser) markdown() goldmark.Markdown {
+	extensions := []goldmark.Extender{extension.TaskList}
+	options := []parser.Option{}
+	for _, e := range goldmarkExtensions {
+		if p.config.Extensions&e.flag != 0 {
+			extensions = append(extensions, e.extender)
+		}
+	}
+	if p.config.Extensions&blackfriday.HeadingIDs != 0 {
+		options = append(options, parser.WithAttribute())
+	}
+	return goldmark.New(goldmark.WithExtensions(extensions...), goldmark.WithParserOptions(options...))
+}
+
+// goldmarkConverter converts a goldmark syntax tree
+type goldmarkConverter struct {
+	source    []byte
+	footnotes map[int][]byte // Labels of the footnotes by index
+	budget    *NodeBudget    // Budget of the converted nodes, nil for no limit
+}
+
+// convert converts a goldmark node and its children, nil for the dropped nodes
+func (c *goldmarkConverter) convert(n ast.Node) *Node {
+	c.budget.add()
+	var node *Node
+	switch n := n.(type) {
+	case *ast.Document:
+		node = NewNode(Document)
+	case *ast.Blockquote:
+		node = NewNode(BlockQuote)
+	case *ast.List:
+		node = NewNode(List)
+		node.Tight = n.IsTight
+		node.Start = n.Start
+		if n.IsOrdered() {
+			node.ListFlags = ListTypeOrdered
+		}
+	case *ast.ListItem:
+		node = NewNode(Item)
+		if list, ok := n.Parent().(*ast.List); ok {
+			node.Tight = list.IsTight
+			if list.IsOrdered() {
+				node.ListFlags = ListTypeOrdered
+			}
+		}
+	case *ast.Paragraph, *ast.TextBlock:
+		node = NewNode(Paragraph)
+	case *ast.Heading:
+		node = NewNode(Heading)
+		node.Level = n.Level
+		if id, ok := n.AttributeString("id"); ok {
+			if id, ok := id.([]byte); ok {
+				node.HeadingID = string(id)
+			}
+		}
+	case *ast.ThematicBreak:
+		return NewNode(HorizontalRule)
+	case *ast.FencedCodeBlock:
+		node = NewNode(CodeBlock)
+		if n.Info != nil {
+			node.Info = n.Info.Segment.Value(c.source)
+		}
+		node.Literal = c.lines(n.Lines())
+		return node
+	case *ast.CodeBlock:
+		node = NewNode(CodeBlock)
+		node.Literal = c.lines(n.Lines())
+		return node
+	case *ast.HTMLBlock:
+		node = NewNode(HTMLBlock)
+		node.Literal = c.lines(n.Lines())
+		if n.HasClosure() {
+			node.Literal = append(node.Literal, n.ClosureLine.Value(c.source)...)
+		}
+		return node
+	case *ast.Text:
+		node = NewNode(Text)
+		node.Literal = append([]byte{}, resolveText(n.Value(c.source))...)
+		if n.SoftLineBreak() {
+			node.Literal = append(node.Literal, '\n')
+		}
+		return node
+	case *ast.String:
+		node = NewNode(Text)
+		node.Literal = append([]byte{}, n.Value...)
+		return node
+	case *ast.CodeSpan:
+		node = NewNode(Code)
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			switch child := child.(type) {
+			case *ast.Text:
+				node.Literal = append(node.Literal, child.Value(c.source)...)
+				if child.SoftLineBreak() {
+					node.Literal = append(node.Literal, ' ')
+				}
+			case *ast.String:
+				node.Literal = append(node.Literal, child.Value...)
+			}
+		}
+		return node
+	case *ast.Emphasis:
+		node = NewNode(Emph)
+		if n.Level == 2 {
+			node.Type = Strong
+		}
+	case *east.Strikethrough:
+		node = NewNode(Del)
+	case *ast.Link:
+		node = NewNode(Link)
+		node.Destination = n.Destination
+		node.Title = n.Title
+		if n.Reference != nil {
+			node.Reference = string(n.Reference.Value)
+		}
+	case *ast.Image:
+		node = NewNode(Image)
+		node.Destination = n.Destination
+		node.Title = n.Title
+	case *ast.AutoLink:
+		node = NewNode(Link)
+		node.Destination = n.URL(c.source)
+		if n.AutoLinkType == ast.AutoLinkEmail {
+			node.Destination = append([]byte("mailto:"), node.Destination...)
+		}
+		label := NewNode(Text)
+		label.Literal = append([]byte{}, n.Label(c.source)...)
+		node.AppendChild(label)
+		return node
+	case *ast.RawHTML:
+		node = NewNode(HTMLSpan)
+		for i := 0; i < n.Segments.Len(); i++ {
+			segment := n.Segments.At(i)
+			node.Literal = append(node.Literal, segment.Value(c.source)...)
+		}
+		return node
+	case *east.TaskCheckBox:
+		node = NewNode(Text)
+		node.Literal = []byte("[ ] ")
+		if n.IsChecked {
+			node.Literal = []byte("[x] ")
+		}
+		return node
+	case *east.Table:
+		return c.convertTable(n)
+	case *east.DefinitionList:
+		node = NewNode(List)
+		node.ListFlags = ListTypeDefinition
+	case *east.DefinitionTerm:
+		// The term wraps its inlines in a paragraph, like blackfriday
+		node = NewNode(Item)
+		node.ListFlags = ListTypeDefinition | ListTypeTerm
+		paragraph := NewNode(Paragraph)
+		c.appendChildren(paragraph, n)
+		node.AppendChild(paragraph)
+		return node
+	case *east.DefinitionDescription:
+		node = NewNode(Item)
+		node.ListFlags = ListTypeDefinition
+	case *east.FootnoteList:
+		node = NewNode(List)
+		node.ListFlags = ListTypeOrdered
+		node.IsFootnotesList = true
+	case *east.Footnote:
+		node = NewNode(Item)
+		node.ListFlags = ListTypeOrdered
+		node.RefLink = n.Ref
+	case *east.FootnoteLink:
+		node = NewNode(Link)
+		node.NoteID = max(n.Index, 1)
+		node.Destination = c.footnotes[n.Index]
+		return node
+	default:
+		// The footnote backlinks are generated by the renderers
+		return nil
+	}
+	c.appendChildren(node, n)
+	return node
+}
+
+// appendChildren converts the children of a goldmark node, merging the adjacent texts and
+// turning the hard line breaks into nodes
+func (c *goldmarkConverter) appendChildren(node *Node, n ast.Node) {
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		converted := c.convert(child)
+		if converted == nil {
+			continue
+		}
+		if last := node.LastChild; converted.Type == Text && last != nil && last.Type == Text {
+			last.Literal = append(last.Literal, converted.Literal...)
+		} else {
+			node.AppendChild(converted)
+		}
+		if text, ok := child.(*ast.Text); ok && text.HardLineBreak() {
+			node.AppendChild(NewNode(Hardbreak))
+		}
+	}
+}
+
+// convertTable converts a table, grouping the header row and the body rows like blackfriday
+func (c *goldmarkConverter) convertTable(table *east.Table) *Node {
+	node := NewNode(Table)
+	var body *Node
+	for child := table.FirstChild(); child != nil; child = child.NextSibling() {
+		c.budget.add()
+		row := NewNode(TableRow)
+		for cell := child.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			c.budget.add()
+			tableCell := NewNode(TableCell)
+			tableCell.IsHeader = child.Kind() == east.KindTableHeader
+			if cell, ok := cell.(*east.TableCell); ok {
+				tableCell.Align = alignments[cell.Alignment]
+			}
+			c.appendChildren(tableCell, cell)
+			row.AppendChild(tableCell)
+		}
+
+		if child.Kind() == east.KindTableHeader {
+			head := NewNode(TableHead)
+			head.AppendChild(row)
+			node.AppendChild(head)
+			continue
+		}
+		if body == nil {
+			body = NewNode(TableBody)
+			node.AppendChild(body)
+		}
+		body.AppendChild(row)
+	}
+	return node
+}
+
+// alignments maps the goldmark cell alignments
+var alignments = map[east.Alignment]CellAlignment{
+	east.AlignLeft:   AlignLeft,
+	east.AlignRight:  AlignRight,
+	east.AlignCenter: AlignCenter,
+}
+
+// lines concatenates the lines of a block
+func (c *goldmarkConverter) lines(lines *text.Segments) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(c.source))
+	}
+	return buf.Bytes()
+}
+
+// resolveText resolves the backslash escapes and the character references of a text,
+// which goldmark leaves to its HTML renderer
+func resolveText(value []byte) []byte {
+	return util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(value)))
+}
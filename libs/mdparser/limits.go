@@ -0,0 +1,148 @@
+package mdparser
+
+import (
+	"fmt"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Limits bound the resources used to convert an untrusted document, a zero limit is not enforced.
+// Documents over the input size or the node count are rejected with a *LimitError,
+// the other limits drop the excess content with a WarningLimit.
+type Limits struct {
+	MaxInputBytes   int // Size of the markdown data
+	MaxNodes        int // Nodes of the syntax tree, including the container blocks
+	MaxDepth        int // Nesting depth of the syntax tree, the deeper nodes are dropped
+	MaxTableRows    int // Body rows of a table, the next rows are dropped
+	MaxTableColumns int // Columns of a table, the next columns are dropped
+	MaxDataURIBytes int // Size of a data URI image, the larger images are dropped
+}
+
+// DefaultLimits are the limits of a new configuration, well above the size of the hand-written documents
+var DefaultLimits = Limits{
+	MaxInputBytes:   16 << 20,
+	MaxNodes:        1_000_000,
+	MaxDepth:        100,
+	MaxTableRows:    10_000,
+	MaxTableColumns: 256,
+	MaxDataURIBytes: 8 << 20,
+}
+
+// LimitError is returned when a document exceeds a limit of the configuration
+type LimitError struct {
+	Limit string // Name of the limit, such as "input bytes" or "nodes"
+	Value int    // Value of the document, when known
+	Max   int    // Value of the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("markdown: %d %s exceed the limit of %d", e.Value, e.Limit, e.Max)
+}
+
+// CheckInput returns a *LimitError when the markdown data exceeds MaxInputBytes
+func (l Limits) CheckInput(markdownData []byte) error {
+	if l.MaxInputBytes > 0 && len(markdownData) > l.MaxInputBytes {
+		return &LimitError{Limit: "input bytes", Value: len(markdownData), Max: l.MaxInputBytes}
+	}
+	return nil
+}
+
+// CheckNodes returns a *LimitError when the count of nodes exceeds MaxNodes
+func (l Limits) CheckNodes(count int) error {
+	if l.MaxNodes > 0 && count > l.MaxNodes {
+		return &LimitError{Limit: "nodes", Value: count, Max: l.MaxNodes}
+	}
+	return nil
+}
+
+// NodeBudget counts the nodes converted from the syntax trees of the backend against MaxNodes,
+// so that a document over the limit is rejected while it is converted rather than afterwards.
+// The document and its container bodies share a budget.
+type NodeBudget struct {
+	Count int // Nodes converted so far
+	Max   int // Limit of the count, 0 for no limit
+}
+
+// add counts a converted node, aborting the conversion with a *LimitError over the limit
+func (b *NodeBudget) add() {
+	if b == nil {
+		return
+	}
+	b.Count++
+	if b.Max > 0 && b.Count > b.Max {
+		Abort(&LimitError{Limit: "nodes", Value: b.Count, Max: b.Max})
+	}
+}
+
+// CountNodes returns the number of nodes of the tree
+func CountNodes(node *Node) int {
+	count := 0
+	node.Walk(func(n *Node, entering bool) WalkStatus {
+		if entering {
+			count++
+		}
+		return GoToNext
+	})
+	return count
+}
+
+// TruncateDepth removes the nodes nested deeper than MaxDepth, the document being at the given depth,
+// and returns the number of nodes removed
+func (l Limits) TruncateDepth(document *Node, depth int) int {
+	if l.MaxDepth <= 0 {
+		return 0
+	}
+	removed := 0
+	document.Walk(func(node *Node, entering bool) WalkStatus {
+		if !node.IsContainer() {
+			return GoToNext
+		}
+		if !entering {
+			depth--
+			return GoToNext
+		}
+		if depth >= l.MaxDepth {
+			for child := node.FirstChild; child != nil; child = node.FirstChild {
+				removed += CountNodes(child)
+				child.Unlink()
+			}
+			return SkipChildren
+		}
+		depth++
+		return GoToNext
+	})
+	return removed
+}
+
+// TruncateDepthBlackfriday removes the nodes of a blackfriday syntax tree nested deeper than MaxDepth,
+// and returns the number of nodes of the tree and of the nodes removed
+func (l Limits) TruncateDepthBlackfriday(document *blackfriday.Node) (count, removed int) {
+	depth := 0
+	document.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering {
+			count++
+		}
+		if !node.IsContainer() {
+			return blackfriday.GoToNext
+		}
+		if !entering {
+			depth--
+			return blackfriday.GoToNext
+		}
+		if l.MaxDepth > 0 && depth >= l.MaxDepth {
+			for child := node.FirstChild; child != nil; child = node.FirstChild {
+				child.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+					if entering {
+						removed++
+					}
+					return blackfriday.GoToNext
+				})
+				child.Unlink()
+			}
+			return blackfriday.SkipChildren
+		}
+		depth++
+		return blackfriday.GoToNext
+	})
+	return count + removed, removed
+}
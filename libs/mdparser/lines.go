@@ -0,0 +1,259 @@
+package mdparser
+
+import (
+	"bytes"
+	"iter"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// reservedCharacters are the private use characters delimiting the placeholders of the syntax
+// replaced before parsing: U+E000 for the containers, U+E001 for the math and U+E002 for the wiki links
+const reservedCharacters = "\uE000\uE001\uE002"
+
+var (
+	// codeFenceRe matches the opening fence of a code block, without its indentation
+	codeFenceRe = regexp.MustCompile("^(?:(`{3,})[^`]*|(~{3,}).*)$")
+	// listMarkerRe matches the marker of a list item, without its indentation
+	listMarkerRe = regexp.MustCompile(`^([-+*]|\d{1,9}[.)])(?:[ \t]|$)`)
+	// thematicBreakRe matches the thematic breaks, which are not list items
+	thematicBreakRe = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	// headingRe matches the ATX headings
+	headingRe = regexp.MustCompile(`^#{1,6}(?:[ \t]|$)`)
+	// containerFenceRe matches the ::: fences of the container blocks
+	containerFenceRe = regexp.MustCompile(`^:{3,}`)
+)
+
+// ReplaceReserved replaces the private use characters reserved for the placeholders, U+E000 to U+E002,
+// with U+FFFD, so that the text of the document cannot be mistaken for a placeholder.
+// It returns the markdown data and the number of characters replaced.
+func ReplaceReserved(markdownData []byte) ([]byte, int) {
+	if !bytes.ContainsAny(markdownData, reservedCharacters) {
+		return markdownData, 0
+	}
+	replaced := 0
+	output := make([]byte, 0, len(markdownData))
+	for len(markdownData) > 0 {
+		r, size := utf8.DecodeRune(markdownData)
+		if strings.ContainsRune(reservedCharacters, r) {
+			output = utf8.AppendRune(output, utf8.RuneError)
+			replaced++
+		} else {
+			output = append(output, markdownData[:size]...)
+		}
+		markdownData = markdownData[size:]
+	}
+	return output, replaced
+}
+
+// Line is a line of a markdown document
+type Line struct {
+	Text string // Line with its line ending
+	Code bool   // Line of a fenced or indented code block, whose markdown syntax is literal
+}
+
+// SplitLines splits the markdown data into its lines, telling the lines of the code blocks apart.
+// The fenced and indented code blocks are found in the block quotes and the list items as well,
+// following the indentation of the items. It is the pre-pass of the syntax replaced before parsing.
+func SplitLines(markdownData []byte) []Line {
+	var s blockScanner
+	lines := []Line{}
+	for _, line := range strings.SplitAfter(string(markdownData), "\n") {
+		if line == "" {
+			continue
+		}
+		lines = append(lines, Line{Text: line, Code: s.code(strings.TrimRight(line, "\r\n"))})
+	}
+	return lines
+}
+
+// listItem is a list item open at a line
+type listItem struct {
+	column int // Column of the content of the item
+	quotes int // Block quote level of the item
+}
+
+// blockScanner follows the block structure of the lines, as far as the code blocks are concerned
+type blockScanner struct {
+	items       []listItem // Open list items, innermost last
+	quotes      int        // Block quote level of the previous line
+	fence       string     // Opening fence of the open fenced code block
+	fenceColumn int        // Column of the content holding the fenced code block
+	fenceQuotes int        // Block quote level of the fenced code block
+	paragraph   bool       // The previous line is paragraph text, which the next lines may continue
+}
+
+// code scans a line without its line ending and reports whether it belongs to a code block
+func (s *blockScanner) code(text string) bool {
+	// Block quote markers, each followed by an optional space
+	column, quotes := 0, 0
+	for {
+		n, c := indentation(text, column)
+		if c-column > 3 || n >= len(text) || text[n] != '>' {
+			break
+		}
+		text, column, quotes = text[n+1:], c+1, quotes+1
+		if strings.HasPrefix(text, " ") {
+			text, column = text[1:], column+1
+		}
+	}
+	n, c := indentation(text, column)
+	text = text[n:]
+	blank := strings.TrimSpace(text) == ""
+
+	if s.fence != "" {
+		if quotes >= s.fenceQuotes && (blank || c >= s.fenceColumn) {
+			if c-s.fenceColumn <= 3 && isClosingFence(text, s.fence) {
+				s.fence = ""
+			}
+			return true
+		}
+		// The container of the code block is closed
+		s.fence = ""
+	}
+	if blank {
+		s.paragraph = false
+		return false
+	}
+
+	// The list items the line is not indented into are closed, unless the line continues a paragraph
+	lazy := s.paragraph && !startsBlock(text)
+	for len(s.items) > 0 {
+		item := s.items[len(s.items)-1]
+		if lazy || (quotes >= item.quotes && c >= item.column) {
+			break
+		}
+		s.items = s.items[:len(s.items)-1]
+	}
+	s.quotes = quotes
+	return s.block(text, c, column)
+}
+
+// block scans the text of a line starting at the column c, in the content starting at the column base
+func (s *blockScanner) block(text string, c, base int) bool {
+	if len(s.items) > 0 {
+		base = max(base, s.items[len(s.items)-1].column)
+	}
+	if c-base >= 4 {
+		// Indented code, unless the line continues a paragraph
+		return !s.paragraph
+	}
+
+	fence := codeFenceRe.FindStringSubmatch(text)
+	switch match := listMarkerRe.FindStringSubmatch(text); {
+	case fence != nil:
+		s.fence = fence[1] + fence[2]
+		s.fenceColumn, s.fenceQuotes = base, s.quotes
+		s.paragraph = false
+		return true
+	case thematicBreakRe.MatchString(text), headingRe.MatchString(text), containerFenceRe.MatchString(text):
+		s.paragraph = false
+		return false
+	case match != nil:
+		// The content of the item starts after the spaces following the marker,
+		// or a single space when it starts with indented code
+		marker := len(match[1])
+		rest := text[marker:]
+		n, content := indentation(rest, c+marker)
+		if strings.TrimSpace(rest) == "" || content-(c+marker) > 4 {
+			n, content = min(n, 1), c+marker+1
+		}
+		s.items = append(s.items, listItem{column: content, quotes: s.quotes})
+		s.paragraph = false
+		if strings.TrimSpace(rest) == "" {
+			return false
+		}
+		text = rest[n:]
+		m, column := indentation(text, content)
+		return s.block(text[m:], column, content)
+	}
+	s.paragraph = true
+	return false
+}
+
+// startsBlock checks if the text of a line interrupts a paragraph
+func startsBlock(text string) bool {
+	return codeFenceRe.MatchString(text) || listMarkerRe.MatchString(text) || thematicBreakRe.MatchString(text) ||
+		headingRe.MatchString(text) || containerFenceRe.MatchString(text)
+}
+
+// isClosingFence checks if the text of a line closes the code block opened by the fence
+func isClosingFence(text, fence string) bool {
+	text = strings.TrimRight(text, " \t")
+	return len(text) >= len(fence) && strings.Trim(text, fence[:1]) == ""
+}
+
+// indentation returns the length of the leading spaces and tabs of the text
+// and the column it ends at, the tabs advancing to the next multiple of 4
+func indentation(text string, column int) (int, int) {
+	n := 0
+	for ; n < len(text); n++ {
+		switch text[n] {
+		case ' ':
+			column++
+		case '\t':
+			column += 4 - column%4
+		default:
+			return n, column
+		}
+	}
+	return n, column
+}
+
+// SplitCodeSpans returns an iterator over the parts of a line of text, telling the `code spans` apart.
+// The backslash escapes are kept in the text parts, so that an escaped backtick does not open a code span.
+func SplitCodeSpans(text string) iter.Seq2[string, bool] {
+	return func(yield func(string, bool) bool) {
+		last := 0
+		for i := 0; i < len(text); {
+			if text[i] == '\\' {
+				i += 2
+				continue
+			}
+			if text[i] != '`' {
+				i++
+				continue
+			}
+			run := backtickRun(text[i:])
+			end := closingRun(text[i+run:], run)
+			if end < 0 {
+				// An unmatched backtick run is literal
+				i += run
+				continue
+			}
+			end += i + 2*run
+			if i > last && !yield(text[last:i], false) {
+				return
+			}
+			if !yield(text[i:end], true) {
+				return
+			}
+			i, last = end, end
+		}
+		if last < len(text) {
+			yield(text[last:], false)
+		}
+	}
+}
+
+// backtickRun returns the length of the backtick run starting the text
+func backtickRun(text string) int {
+	return len(text) - len(strings.TrimLeft(text, "`"))
+}
+
+// closingRun returns the index of the backtick run of the length closing a code span, or -1
+func closingRun(text string, length int) int {
+	for i := 0; i < len(text); {
+		if text[i] != '`' {
+			i++
+			continue
+		}
+		run := backtickRun(text[i:])
+		if run == length {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
@@ -0,0 +1,56 @@
+package mdparser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Backends of the markdown parser
+const (
+	BackendBlackfriday = "blackfriday" // Blackfriday, the default backend
+	BackendGoldmark    = "goldmark"    // Goldmark, compliant with CommonMark and GFM
+)
+
+// referenceDefinitionRe matches reference definitions such as [label]: <url> "title"
+var referenceDefinitionRe = regexp.MustCompile(`(?m)^ {0,3}\[([^\]^][^\]]*)\]:[ \t]*<?([^\s>]+)>?(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*$`)
+
+// Parser parses markdown into the parser-neutral syntax tree
+type Parser interface {
+	// Parse parses the markdown data. The references resolve the reference links
+	// defined outside of the data, such as the links of a container body.
+	Parse(markdownData []byte, references []Reference) *Node
+}
+
+// Reference is a link reference definition, such as [label]: <url> "title"
+type Reference struct {
+	Label       string
+	Destination string
+	Title       string
+}
+
+// ExtractReferences returns the link reference definitions of the markdown data
+func ExtractReferences(markdownData []byte) []Reference {
+	references := []Reference{}
+	for _, match := range referenceDefinitionRe.FindAllSubmatch(markdownData, -1) {
+		references = append(references, Reference{
+			Label:       string(match[1]),
+			Destination: string(match[2]),
+			Title:       string(match[3]) + string(match[4]) + string(match[5]),
+		})
+	}
+	return references
+}
+
+// Parser returns the parser of the configured backend
+func (c *Config) Parser() Parser {
+	return c.ParserWithBudget(nil)
+}
+
+// ParserWithBudget returns the parser of the configured backend, counting the converted nodes in the budget.
+// The parser aborts with a *LimitError over the budget, the caller recovers it with Recover.
+func (c *Config) ParserWithBudget(budget *NodeBudget) Parser {
+	if strings.EqualFold(c.Backend, BackendGoldmark) {
+		return &goldmarkParser{config: c, budget: budget}
+	}
+	return &blackfridayParser{config: c, budget: budget}
+}
@@ -0,0 +1,56 @@
+package mdparser
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// LocalPath returns the path of a file named by a document, such as an image or an embedded page,
+// relative to the directory of the document. The name is cleaned, an absolute name is rooted in the
+// directory, and the names leading outside of the directory are rejected. The symbolic links are
+// resolved before the check, a link inside the directory pointing outside of it is rejected as well.
+// A missing file is not rejected, it is reported when it is opened.
+func LocalPath(dir, name string) (string, bool) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if !inside(dir, path) {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path, errors.Is(err, fs.ErrNotExist)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil || !inside(root, resolved) {
+		return "", false
+	}
+	return resolved, true
+}
+
+// inside tells whether the path is inside the directory
+func inside(dir, path string) bool {
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// OpenRegular opens a regular file for reading. The file is opened without blocking and its mode is
+// checked on the open file, a FIFO or a device named by an untrusted document could block the reads.
+func OpenRegular(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, errors.New("not a regular file")
+	}
+	return f, nil
+}
@@ -0,0 +1,183 @@
+package mdparser
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kyokomi/emoji/v2"
+)
+
+var (
+	// emojiRe matches the emoji shortcodes, such as :smile: or :+1:
+	emojiRe = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+	// abbreviationRe matches the abbreviation definitions, such as *[HTML]: HyperText Markup Language
+	abbreviationRe = regexp.MustCompile(`^ {0,3}\*\[([^\]]+)\]:[ \t]*(.*?)[ \t]*$`)
+)
+
+// Emojize replaces the known emoji shortcodes of the text with their emoji
+func Emojize(text string) string {
+	if !strings.Contains(text, ":") {
+		return text
+	}
+	codes := emoji.CodeMap()
+	return emojiRe.ReplaceAllStringFunc(text, func(code string) string {
+		if value, ok := codes[code]; ok {
+			return value
+		}
+		return code
+	})
+}
+
+// Smarten converts the straight quotes of the text to curly quotes, -- and --- to en and em dashes
+// and ... to an ellipsis. The previous character tells the opening quotes from the closing ones.
+func Smarten(text string, previous rune) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		var replacement rune
+		size := 1
+		switch {
+		case strings.HasPrefix(text[i:], "---"):
+			replacement, size = '—', 3
+		case strings.HasPrefix(text[i:], "--"):
+			replacement, size = '–', 2
+		case strings.HasPrefix(text[i:], "..."):
+			replacement, size = '…', 3
+		case text[i] == '"' && isOpening(previous):
+			replacement = '“'
+		case text[i] == '"':
+			replacement = '”'
+		case text[i] == '\'' && isOpening(previous):
+			replacement = '‘'
+		case text[i] == '\'':
+			// Closing quotes and apostrophes
+			replacement = '’'
+		default:
+			r, n := utf8.DecodeRuneInString(text[i:])
+			sb.WriteString(text[i : i+n])
+			previous = r
+			i += n
+			continue
+		}
+		sb.WriteRune(replacement)
+		previous = replacement
+		i += size
+	}
+	return sb.String()
+}
+
+// isOpening checks if a quote following the character opens a quotation
+func isOpening(previous rune) bool {
+	return unicode.IsSpace(previous) || strings.ContainsRune("([{<“‘—–-", previous)
+}
+
+// lastRune returns the last character of a non-empty text
+func lastRune(text string) rune {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return r
+}
+
+// Abbreviation is an abbreviation with its expansion
+type Abbreviation struct {
+	Abbr  string `json:"abbr"`
+	Title string `json:"title"`
+}
+
+// Abbreviations are the abbreviations defined in a document
+type Abbreviations struct {
+	Definitions []Abbreviation // Definitions in order of appearance
+
+	re *regexp.Regexp // Matches the abbreviations as whole words
+}
+
+// ExtractAbbreviations removes the *[ABBR]: definitions of the markdown data, outside of the code blocks.
+// The first definition of an abbreviation wins.
+func ExtractAbbreviations(markdownData []byte) ([]byte, *Abbreviations) {
+	var output bytes.Buffer
+	abbreviations := &Abbreviations{}
+	defined := map[string]bool{}
+
+	for _, line := range SplitLines(markdownData) {
+		match := abbreviationRe.FindStringSubmatch(strings.TrimRight(line.Text, "\r\n"))
+		if line.Code || match == nil {
+			output.WriteString(line.Text)
+			continue
+		}
+		abbr := strings.TrimSpace(match[1])
+		if !defined[abbr] {
+			defined[abbr] = true
+			abbreviations.Definitions = append(abbreviations.Definitions, Abbreviation{Abbr: abbr, Title: match[2]})
+		}
+		// The definitions are replaced by blank lines, keeping the paragraphs apart
+		output.WriteString("\n")
+	}
+
+	if len(abbreviations.Definitions) == 0 {
+		return output.Bytes(), nil
+	}
+
+	// The longest abbreviations are matched first
+	words := make([]string, 0, len(abbreviations.Definitions))
+	for _, definition := range abbreviations.Definitions {
+		words = append(words, regexp.QuoteMeta(definition.Abbr))
+	}
+	sort.SliceStable(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	abbreviations.re = regexp.MustCompile(`\b(?:` + strings.Join(words, "|") + `)\b`)
+	return output.Bytes(), abbreviations
+}
+
+// Title returns the expansion of an abbreviation
+func (a *Abbreviations) Title(abbr string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	for _, definition := range a.Definitions {
+		if definition.Abbr == abbr {
+			return definition.Title, true
+		}
+	}
+	return "", false
+}
+
+// Part is a part of a text, either plain text or an abbreviation
+type Part struct {
+	Text         string
+	Abbreviation *Abbreviation
+}
+
+// Split splits a text into its plain text and abbreviation parts
+func (a *Abbreviations) Split(text string) []Part {
+	if a == nil || a.re == nil {
+		return []Part{{Text: text}}
+	}
+
+	parts := []Part{}
+	last := 0
+	for _, loc := range a.re.FindAllStringIndex(text, -1) {
+		title, _ := a.Title(text[loc[0]:loc[1]])
+		if loc[0] > last {
+			parts = append(parts, Part{Text: text[last:loc[0]]})
+		}
+		parts = append(parts, Part{Abbreviation: &Abbreviation{Abbr: text[loc[0]:loc[1]], Title: title}})
+		last = loc[1]
+	}
+	if last < len(text) {
+		parts = append(parts, Part{Text: text[last:]})
+	}
+	return parts
+}
+
+// Markdown returns the markdown definitions of the abbreviations
+func (a *Abbreviations) Markdown() string {
+	if a == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, definition := range a.Definitions {
+		sb.WriteString("*[" + definition.Abbr + "]: " + definition.Title + "\n")
+	}
+	return sb.String()
+}
@@ -1,27 +1,143 @@
 package mdrenderer
 
 import (
+	"bytes"
+	"context"
 	"io"
-	"log"
+	"slices"
 	"strconv"
 	"strings"
 
 	bf "github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdmath"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 )
 
 // Option defines the functional option type
 type Option func(r *Renderer)
 
+// WithParserConfig sets the configuration of the markdown parser. The renderer only supports
+// the blackfriday backend, another backend is warned about and parsed with blackfriday.
+func WithParserConfig(config *mdparser.Config) Option {
+	return func(r *Renderer) {
+		r.config = config
+	}
+}
+
+// Converter renders markdown documents back to markdown. It is configured once and holds
+// no state of the documents, each rendering runs on a fresh Renderer, so that a Converter
+// can be shared between goroutines. The parser configuration must not be modified afterwards.
+type Converter struct {
+	options []Option
+}
+
+// NewConverter creates a converter with the options of the renderer
+func NewConverter(options ...Option) *Converter {
+	return &Converter{options: slices.Clone(options)}
+}
+
+// Convert renders the markdown data back to markdown, see Renderer.Convert
+func (c *Converter) Convert(ctx context.Context, markdownData []byte) (Result, error) {
+	return NewRenderer(c.options...).Convert(ctx, markdownData)
+}
+
 // NewRenderer will return a new renderer with sane defaults
 func NewRenderer(options ...Option) *Renderer {
-	r := &Renderer{}
+	r := &Renderer{
+		footnoteRefs: map[string]int{},
+		config:       mdparser.NewConfig(),
+	}
 	for _, option := range options {
 		option(r)
 	}
 	return r
 }
 
-// Renderer is a custom Blackfriday renderer
+// Result is the result of the rendering of a markdown document
+type Result struct {
+	Markdown []byte             // Rendered markdown
+	Warnings []mdparser.Warning // Non-fatal problems found during the rendering
+}
+
+// Convert renders the markdown data back to markdown, with the warnings of the rendering,
+// see RenderContext for the errors
+func (r *Renderer) Convert(ctx context.Context, markdownData []byte) (Result, error) {
+	out, err := r.RenderContext(ctx, markdownData)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Markdown: out, Warnings: r.warnings}, nil
+}
+
+// Render renders the markdown data back to markdown with the renderer, see RenderContext for the errors
+func (r *Renderer) Render(markdownData []byte) (out []byte, err error) {
+	return r.RenderContext(context.Background(), markdownData)
+}
+
+// RenderContext renders the markdown data back to markdown with the renderer.
+// With the Math option, the $inline$ and $$display$$ math is protected from the inline parsing
+// and written verbatim; the abbreviation definitions are written at the end.
+// The context is checked between the nodes, the rendering returns ctx.Err() once it is done.
+// A document over the input size or the node count of the limits is rejected with a *mdparser.LimitError.
+// An unexpected failure of the rendering is returned as an *mdparser.InternalError.
+// The document is always parsed with blackfriday, another backend of the configuration is warned about.
+func (r *Renderer) RenderContext(ctx context.Context, markdownData []byte) (out []byte, err error) {
+	defer mdparser.Recover(&err)
+
+	r.warnings = nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(r.config.Backend, mdparser.BackendBlackfriday) {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningBackend, "parser backend %q not supported, parsed with blackfriday", r.config.Backend))
+	}
+	if err := r.config.Limits.CheckInput(markdownData); err != nil {
+		return nil, err
+	}
+	markdownData, abbreviations := r.config.Preprocess(markdownData)
+	var math mdmath.Spans
+	if r.config.Math {
+		var replaced int
+		if markdownData, replaced = mdparser.ReplaceReserved(markdownData); replaced > 0 {
+			r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningInput, "reserved private use characters U+E000 to U+E002 replaced: %d", replaced))
+		}
+		markdownData, math = mdmath.Protect(markdownData)
+	}
+	document := r.config.ParseBlackfriday(markdownData)
+	count, removed := r.config.Limits.TruncateDepthBlackfriday(document)
+	if err := r.config.Limits.CheckNodes(count); err != nil {
+		return nil, err
+	}
+	if removed > 0 {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningLimit, "nodes nested deeper than %d dropped: %d", r.config.Limits.MaxDepth, removed))
+	}
+	r.config.TransformBlackfriday(document)
+
+	buf := mdparser.GetBuffer()
+	defer mdparser.PutBuffer(buf)
+	r.RenderHeader(buf, document)
+	document.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if err = ctx.Err(); err != nil {
+			return bf.Terminate
+		}
+		return r.RenderNode(buf, node, entering)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.RenderFooter(buf, document)
+
+	// The buffer goes back to the pool
+	out = bytes.Clone(buf.Bytes())
+	if definitions := abbreviations.Markdown(); definitions != "" {
+		out = append(bytes.TrimRight(out, "\n"), "\n\n"+definitions...)
+	}
+	return math.Restore(out), nil
+}
+
+// Renderer is a custom Blackfriday renderer, it renders a single document: use a Converter
+// to render several documents, possibly from several goroutines. It parses with blackfriday
+// whatever the backend of the parser configuration.
 type Renderer struct {
 	paragraphDecoration []byte
 	nestedListLevel     int
@@ -29,22 +145,34 @@ type Renderer struct {
 	tableAlignment      []bf.CellAlignFlags
 	inTableHeader       bool
 	tableCellCounter    int
-	indentLevel         int // New field for indentation level
+	indentLevel         int                // New field for indentation level
+	footnoteRefs        map[string]int     // Number of references to each footnote
+	footnoteOrder       []string           // Footnote labels in order of first reference
+	warnings            []mdparser.Warning // Non-fatal problems found during the rendering
+	config              *mdparser.Config
 }
 
 // skipParagraphNewline returns true if the paragraph should not have an empty line after it
 func skipParagraphNewline(node *bf.Node) bool {
 	parent := node.Parent
-	if parent != nil && parent.Type == bf.BlockQuote {
+	if parent == nil {
+		return false
+	}
+	if parent.Type == bf.BlockQuote {
 		return true
 	}
 
-	grandparent := node.Parent.Parent
-	if grandparent == nil || grandparent.Type != bf.List {
-		return false
+	// Terms and definitions are only separated from the next term
+	if parent.Type == bf.Item && parent.ListFlags&bf.ListTypeDefinition != 0 {
+		if node.Next != nil {
+			return false
+		}
+		return parent.ListFlags&bf.ListTypeTerm != 0 ||
+			(parent.Next != nil && parent.Next.ListFlags&bf.ListTypeTerm == 0)
 	}
 
-	return grandparent.Type == bf.List && grandparent.Tight
+	grandparent := parent.Parent
+	return grandparent != nil && grandparent.Type == bf.List && grandparent.Tight
 }
 
 // returns the current indentation based on the nesting level
@@ -67,6 +195,9 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			w.Write([]byte("\n"))
 		}
 	case bf.List:
+		if entering && node.IsFootnotesList {
+			r.sortFootnotes(node)
+		}
 		if entering {
 			r.nestedListLevel++
 			r.orderedListCounters = append(r.orderedListCounters, 0)
@@ -79,15 +210,24 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			}
 		}
 	case bf.Item:
+		if node.RefLink != nil {
+			r.renderFootnote(w, node, entering)
+			break
+		}
 		if entering {
 			w.Write(r.currentIndentation())
 			r.indentLevel++
-			if node.ListFlags&bf.ListTypeOrdered != 0 {
+			switch {
+			case node.ListFlags&bf.ListTypeTerm != 0:
+				// Terms have no marker
+			case node.ListFlags&bf.ListTypeDefinition != 0:
+				w.Write([]byte(": "))
+			case node.ListFlags&bf.ListTypeOrdered != 0:
 				r.orderedListCounters[len(r.orderedListCounters)-1]++
 				counter := strconv.Itoa(r.orderedListCounters[len(r.orderedListCounters)-1])
 				w.Write([]byte(counter))
 				w.Write([]byte{node.ListData.Delimiter, ' '})
-			} else {
+			default:
 				w.Write([]byte{node.ListData.BulletChar, ' '})
 			}
 		} else { // leaving
@@ -123,13 +263,24 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 	case bf.Del:
 		w.Write([]byte("~~"))
 	case bf.Link:
+		if node.NoteID != 0 {
+			// Footnote reference
+			if r.footnoteRefs[string(node.Destination)] == 0 {
+				r.footnoteOrder = append(r.footnoteOrder, string(node.Destination))
+			}
+			r.footnoteRefs[string(node.Destination)]++
+			w.Write([]byte("[^"))
+			w.Write(node.Destination)
+			w.Write([]byte("]"))
+			return bf.SkipChildren
+		}
 		if entering {
 			w.Write([]byte("["))
 		} else { // leaving
 			w.Write([]byte("]("))
 			w.Write(node.LinkData.Destination)
 			if len(node.LinkData.Title) > 0 {
-				w.Write([]byte(""))
+				w.Write([]byte(` "`))
 				w.Write(node.LinkData.Title)
 				w.Write([]byte(`"`))
 			}
@@ -142,7 +293,7 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			w.Write([]byte("]("))
 			w.Write(node.LinkData.Destination)
 			if len(node.LinkData.Title) > 0 {
-				w.Write([]byte(""))
+				w.Write([]byte(` "`))
 				w.Write(node.LinkData.Title)
 				w.Write([]byte(`"`))
 			}
@@ -221,11 +372,64 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			}
 		}
 	default:
-		log.Printf("Unknown node type: %s\n", node.Type)
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningNode, "unknown node type %s", node.Type))
 	}
 	return bf.GoToNext
 }
 
+// renderFootnote renders a footnote definition of the footnotes list
+func (r *Renderer) renderFootnote(w io.Writer, node *bf.Node, entering bool) {
+	if entering {
+		dropRepeatedFootnoteContent(node, r.footnoteRefs[string(node.RefLink)])
+		w.Write([]byte("[^"))
+		w.Write(node.RefLink)
+		w.Write([]byte("]: "))
+		r.indentLevel++
+	} else { // leaving
+		r.indentLevel--
+		if node.ListFlags&bf.ListItemContainsBlock == 0 {
+			w.Write([]byte("\n\n"))
+		}
+	}
+}
+
+// sortFootnotes orders the footnotes list by first reference,
+// as repeated references move a footnote to the end of the list
+func (r *Renderer) sortFootnotes(list *bf.Node) {
+	for _, label := range r.footnoteOrder {
+		for item := list.FirstChild; item != nil; item = item.Next {
+			if string(item.RefLink) == label {
+				item.Unlink()
+				list.AppendChild(item)
+				break
+			}
+		}
+	}
+}
+
+// dropRepeatedFootnoteContent removes the copies of the footnote content
+// TODO: this is a bug in the Blackfriday library, which parses the content
+// of a footnote once per reference. Remove this when fixed
+func dropRepeatedFootnoteContent(item *bf.Node, refs int) {
+	count := 0
+	for n := item.FirstChild; n != nil; n = n.Next {
+		count++
+	}
+	if refs < 2 || count%refs != 0 {
+		return
+	}
+
+	n := item.FirstChild
+	for i := 0; i < count/refs; i++ {
+		n = n.Next
+	}
+	for n != nil {
+		next := n.Next
+		n.Unlink()
+		n = next
+	}
+}
+
 // RenderHeader satisfies the Renderer interface
 func (r *Renderer) RenderHeader(w io.Writer, ast *bf.Node) {
 	// No action needed
@@ -1,11 +1,15 @@
 package mdrenderer_test
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
-	"github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 	"github.com/stencilframe/mdtools/libs/mdrenderer"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,12 +19,37 @@ func TestMdRenderer(t *testing.T) {
 		name             string
 		inputFileName    string
 		expectedFileName string
+		options          []mdrenderer.Option
 	}{
 		{
 			name:             "Full",
 			inputFileName:    "testdata/lists.md",
 			expectedFileName: "testdata/lists.md",
 		},
+		{
+			name:             "Definitions",
+			inputFileName:    "testdata/definitions.md",
+			expectedFileName: "testdata/definitions.md",
+		},
+		{
+			name:             "Footnotes",
+			inputFileName:    "testdata/footnotes.md",
+			expectedFileName: "testdata/footnotes.md",
+		},
+		{
+			name:             "Math",
+			inputFileName:    "testdata/math.md",
+			expectedFileName: "testdata/math.md",
+			options:          []mdrenderer.Option{mdrenderer.WithParserConfig(mdparser.NewConfig(mdparser.WithMath()))},
+		},
+		{
+			name:             "Typography",
+			inputFileName:    "testdata/typography.md",
+			expectedFileName: "testdata/typography.rendered.md",
+			options: []mdrenderer.Option{mdrenderer.WithParserConfig(mdparser.NewConfig(
+				mdparser.WithEmoji(), mdparser.WithAbbreviations(), mdparser.WithSmartTypography(),
+			))},
+		},
 	}
 
 	for _, tt := range tests {
@@ -30,13 +59,11 @@ func TestMdRenderer(t *testing.T) {
 			assert.NoError(t, err)
 
 			// Initialize a new JSONRenderer
-			renderer := mdrenderer.NewRenderer()
+			renderer := mdrenderer.NewRenderer(tt.options...)
 
 			// Convert the markdown to JSON
-			out := blackfriday.Run(markdownData,
-				blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.AutoHeadingIDs|blackfriday.Tables),
-				blackfriday.WithRenderer(renderer),
-			)
+			out, err := renderer.Render(markdownData)
+			assert.NoError(t, err)
 
 			// Assert the resulting JSON
 			expectedData, err := os.ReadFile(tt.expectedFileName)
@@ -48,3 +75,102 @@ func TestMdRenderer(t *testing.T) {
 		})
 	}
 }
+
+func TestConvert(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/lists.md")
+	assert.NoError(t, err)
+
+	out, err := mdrenderer.NewRenderer().Render(markdownData)
+	assert.NoError(t, err)
+	result, err := mdrenderer.NewRenderer().Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+	assert.Equal(t, out, result.Markdown)
+	assert.Empty(t, result.Warnings)
+
+	// The renderer parses with blackfriday whatever the backend
+	config := mdparser.NewConfig(mdparser.WithBackend(mdparser.BackendGoldmark))
+	result, err = mdrenderer.NewRenderer(mdrenderer.WithParserConfig(config)).Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+	assert.Equal(t, out, result.Markdown)
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningBackend, Message: `parser backend "goldmark" not supported, parsed with blackfriday`},
+	}, result.Warnings)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mdrenderer.NewRenderer().Convert(ctx, markdownData)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestConverter(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(t, err)
+
+	expected := make([]string, len(files))
+	for i, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		out, err := mdrenderer.NewRenderer().Render(markdownData)
+		assert.NoError(t, err)
+		expected[i] = string(out)
+	}
+
+	// The documents are rendered concurrently by a shared converter, several times each
+	converter := mdrenderer.NewConverter()
+	actual := make([]string, 4*len(files))
+	var wg sync.WaitGroup
+	for i := range actual {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			markdownData, err := os.ReadFile(files[i%len(files)])
+			assert.NoError(t, err)
+			result, err := converter.Convert(context.Background(), markdownData)
+			assert.NoError(t, err)
+			actual[i] = string(result.Markdown)
+		}()
+	}
+	wg.Wait()
+	for i := range actual {
+		assert.Equal(t, expected[i%len(files)], actual[i], files[i%len(files)])
+	}
+}
+
+func TestLimits(t *testing.T) {
+	renderer := mdrenderer.NewRenderer(mdrenderer.WithParserConfig(mdparser.NewConfig(
+		mdparser.WithLimits(mdparser.Limits{MaxInputBytes: 32, MaxDepth: 3}),
+	)))
+	result, err := renderer.Convert(context.Background(), []byte("> > quote\n\nText\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "> > \n\n\nText", strings.TrimSpace(string(result.Markdown)))
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningLimit, Message: "nodes nested deeper than 3 dropped: 1"},
+	}, result.Warnings)
+
+	var limitError *mdparser.LimitError
+	_, err = renderer.Render([]byte(strings.Repeat("Text ", 10)))
+	assert.ErrorAs(t, err, &limitError)
+}
+
+func FuzzRenderer(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(f, err)
+	for _, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(f, err)
+		f.Add(markdownData)
+	}
+	f.Add([]byte("> quote\n"))
+	f.Add([]byte("| |\n|-|\n| a |\n"))
+
+	f.Fuzz(func(t *testing.T, markdownData []byte) {
+		renderer := mdrenderer.NewRenderer(mdrenderer.WithParserConfig(mdparser.NewConfig(
+			mdparser.WithEmoji(), mdparser.WithAbbreviations(), mdparser.WithSmartTypography(),
+		)))
+		_, err := renderer.Render(markdownData)
+		var internalError *mdparser.InternalError
+		if errors.As(err, &internalError) {
+			t.Fatalf("%v\n%s", err, internalError.Stack)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package mdspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdchunk"
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	"github.com/stencilframe/mdtools/libs/mdrenderer"
+	"github.com/stencilframe/mdtools/libs/mdtojson"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// maxChunkSize keeps the markdown written from the JSON nodes in a single chunk
+const maxChunkSize = 1 << 30
+
+// interTagSpaceRe matches the white space between two tags, which the HTML comparison ignores
+var interTagSpaceRe = regexp.MustCompile(`>\s+<`)
+
+// referenceExtensions are the goldmark extensions of the GFM examples
+var referenceExtensions = map[string]goldmark.Extender{
+	"table":         extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	"strikethrough": extension.Strikethrough,
+	"tasklist":      extension.TaskList,
+	"autolink":      extension.Linkify,
+}
+
+// Check verifies an example, returning the reason of its failure
+type Check struct {
+	Name string
+	Run  func(example Example) error
+}
+
+// RoundTrip checks that the markdown written from the JSON nodes is parsed back into the same nodes
+func RoundTrip(config *mdparser.Config) Check {
+	return Check{Name: "roundtrip", Run: func(example Example) error {
+		nodes, markdown, err := jsonMarkdown(config, example.Markdown)
+		if err != nil {
+			return err
+		}
+		reparsed, _, err := jsonMarkdown(config, markdown)
+		if err != nil {
+			return err
+		}
+
+		expected, err := json.Marshal(nodes)
+		if err != nil {
+			return err
+		}
+		actual, err := json.Marshal(reparsed)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(expected, actual) {
+			return fmt.Errorf("re-parsed nodes differ\nmarkdown: %q\nexpected: %s\nactual:   %s", markdown, expected, actual)
+		}
+		return nil
+	}}
+}
+
+// JSON checks that the markdown written from the JSON nodes renders the HTML of the spec
+func JSON(config *mdparser.Config) Check {
+	return Check{Name: "json", Run: func(example Example) error {
+		_, markdown, err := jsonMarkdown(config, example.Markdown)
+		if err != nil {
+			return err
+		}
+		return compareHTML(example, markdown)
+	}}
+}
+
+// Renderer checks that the markdown written by the markdown renderer renders the HTML of the spec
+func Renderer(config *mdparser.Config) Check {
+	return Check{Name: "renderer", Run: func(example Example) error {
+		markdown, err := mdrenderer.NewRenderer(mdrenderer.WithParserConfig(config)).Render([]byte(example.Markdown))
+		if err != nil {
+			return err
+		}
+		return compareHTML(example, string(markdown))
+	}}
+}
+
+// Reference checks that the reference renderer renders the HTML of the spec from the example itself
+func Reference() Check {
+	return Check{Name: "reference", Run: func(example Example) error {
+		return compareHTML(example, example.Markdown)
+	}}
+}
+
+// jsonMarkdown parses the markdown into JSON nodes and writes them back to markdown with the chunker
+func jsonMarkdown(config *mdparser.Config, markdown string) ([]mdtojson.Node, string, error) {
+	nodes, err := mdtojson.NewJSONRenderer(mdtojson.WithParserConfig(config)).Parse([]byte(markdown))
+	if err != nil {
+		return nil, "", err
+	}
+	chunker := mdchunk.NewMarkdownChunk(maxChunkSize, mdchunk.WithImageMode(mdchunk.ImageModeInline))
+	return nodes, strings.Join(chunker.ChunkJSONMarkdown(maxChunkSize, nodes), ""), nil
+}
+
+// compareHTML compares the HTML of the markdown rendered by the reference renderer with the HTML of the example
+func compareHTML(example Example, markdown string) error {
+	actual, err := referenceHTML(example, markdown)
+	if err != nil {
+		return err
+	}
+	if normalizeHTML(actual) != normalizeHTML(example.HTML) {
+		return fmt.Errorf("HTML differs\nmarkdown: %q\nexpected: %q\nactual:   %q", markdown, example.HTML, actual)
+	}
+	return nil
+}
+
+// referenceHTML renders the markdown to HTML with goldmark, which is CommonMark compliant,
+// enabling the GFM extension of the example
+func referenceHTML(example Example, markdown string) (string, error) {
+	extensions := []goldmark.Extender{}
+	if extender, ok := referenceExtensions[example.Extension]; ok {
+		extensions = append(extensions, extender)
+	}
+	md := goldmark.New(goldmark.WithExtensions(extensions...), goldmark.WithRendererOptions(html.WithUnsafe()))
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(markdown), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// normalizeHTML removes the white space between the tags and around the HTML,
+// and writes the void elements such as <hr /> without the closing slash
+func normalizeHTML(s string) string {
+	s = strings.ReplaceAll(s, " />", ">")
+	return interTagSpaceRe.ReplaceAllString(strings.TrimSpace(s), "><")
+}
@@ -0,0 +1,221 @@
+// Package mdspec runs the CommonMark and GFM spec examples through the converters,
+// telling which markdown constructs are handled faithfully.
+//
+// The examples go through two paths:
+//   - parse → JSON → markdown chunk → re-parse, with the JSON renderer and the chunker
+//   - markdown → markdown, with the markdown renderer
+//
+// The markdown written by each path is converted to HTML by a CommonMark compliant
+// reference renderer and compared with the HTML of the spec.
+package mdspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Example is an example of the CommonMark or GFM spec
+type Example struct {
+	Markdown  string `json:"markdown"`
+	HTML      string `json:"html"`
+	Example   int    `json:"example"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Section   string `json:"section"`
+	Extension string `json:"extension,omitempty"` // GFM extension of the example: table, strikethrough, tasklist or autolink
+}
+
+// LoadExamples reads the examples of a spec from a JSON file, in the format of the CommonMark spec.json
+func LoadExamples(path string) ([]Example, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	examples := []Example{}
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return examples, nil
+}
+
+// Result is the result of a check on an example
+type Result struct {
+	Example Example
+	Check   string
+	Err     error // Reason of the failure, nil when the example passes
+}
+
+// Run runs the checks on the examples, a panic fails the check
+func Run(examples []Example, checks []Check) *Report {
+	report := &Report{Checks: []string{}}
+	for _, check := range checks {
+		report.Checks = append(report.Checks, check.Name)
+	}
+	for _, example := range examples {
+		for _, check := range checks {
+			report.Results = append(report.Results, Result{Example: example, Check: check.Name, Err: run(check, example)})
+		}
+	}
+	return report
+}
+
+// run runs a check on an example, recovering from the panics of the converters
+func run(check Check, example Example) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return check.Run(example)
+}
+
+// Report holds the results of the checks on the examples of a spec
+type Report struct {
+	Checks  []string // Names of the checks, in order of execution
+	Results []Result
+}
+
+// SectionStats are the pass counts of a check on the examples of a section
+type SectionStats struct {
+	Section string
+	Check   string
+	Passed  int
+	Total   int
+}
+
+// Failures returns the numbers of the examples failing the check
+func (r *Report) Failures(check string) []int {
+	failures := []int{}
+	for _, result := range r.Results {
+		if result.Check == check && result.Err != nil {
+			failures = append(failures, result.Example.Example)
+		}
+	}
+	return failures
+}
+
+// Sections returns the pass counts by section and check, in order of appearance
+func (r *Report) Sections() []SectionStats {
+	stats := []SectionStats{}
+	index := map[[2]string]int{}
+	for _, result := range r.Results {
+		key := [2]string{result.Example.Section, result.Check}
+		i, ok := index[key]
+		if !ok {
+			i = len(stats)
+			index[key] = i
+			stats = append(stats, SectionStats{Section: key[0], Check: key[1]})
+		}
+		stats[i].Total++
+		if result.Err == nil {
+			stats[i].Passed++
+		}
+	}
+	return stats
+}
+
+// String formats the pass rates of the checks by section, followed by the totals
+func (r *Report) String() string {
+	sections := []string{}
+	rates := map[string]map[string]SectionStats{}
+	totals := map[string]*SectionStats{}
+	for _, stats := range r.Sections() {
+		if _, ok := rates[stats.Section]; !ok {
+			sections = append(sections, stats.Section)
+			rates[stats.Section] = map[string]SectionStats{}
+		}
+		rates[stats.Section][stats.Check] = stats
+		if totals[stats.Check] == nil {
+			totals[stats.Check] = &SectionStats{Check: stats.Check}
+		}
+		totals[stats.Check].Passed += stats.Passed
+		totals[stats.Check].Total += stats.Total
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Section\t"+strings.Join(r.Checks, "\t"))
+	for _, section := range sections {
+		row := []string{section}
+		for _, check := range r.Checks {
+			row = append(row, passRate(rates[section][check]))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	row := []string{"Total"}
+	for _, check := range r.Checks {
+		if total := totals[check]; total != nil {
+			row = append(row, passRate(*total))
+		}
+	}
+	fmt.Fprintln(w, strings.Join(row, "\t"))
+	w.Flush()
+	return sb.String()
+}
+
+// passRate formats the passed examples with their percentage
+func passRate(stats SectionStats) string {
+	if stats.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%d%%)", stats.Passed, stats.Total, stats.Passed*100/stats.Total)
+}
+
+// Allowlist holds the examples known to fail, by spec and check such as "commonmark/blackfriday/json"
+type Allowlist map[string][]int
+
+// LoadAllowlist reads an allowlist from a JSON file
+func LoadAllowlist(path string) (Allowlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	allowlist := Allowlist{}
+	if err := json.Unmarshal(data, &allowlist); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return allowlist, nil
+}
+
+// Save writes the allowlist to a JSON file, one key per line
+func (a Allowlist) Save(path string) error {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for i, key := range keys {
+		examples, _ := json.Marshal(a[key])
+		fmt.Fprintf(&sb, "  %q: %s", key, strings.ReplaceAll(string(examples), ",", ", "))
+		if i < len(keys)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}\n")
+	return os.WriteFile(path, []byte(sb.String()), 0o644)
+}
+
+// Compare compares the failures with the known failures of a key, returning
+// the unexpected failures and the known failures which now pass
+func (a Allowlist) Compare(key string, failures []int) (unexpected, fixed []int) {
+	known := a[key]
+	for _, example := range failures {
+		if !slices.Contains(known, example) {
+			unexpected = append(unexpected, example)
+		}
+	}
+	for _, example := range known {
+		if !slices.Contains(failures, example) {
+			fixed = append(fixed, example)
+		}
+	}
+	return unexpected, fixed
+}
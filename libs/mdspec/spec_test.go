@@ -0,0 +1,119 @@
+package mdspec
+
+import (
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	"github.com/stretchr/testify/assert"
+)
+
+// allowlistPath is the file of the examples known to fail, rewritten by go test -run TestSpec -update
+const allowlistPath = "testdata/known_failures.json"
+
+var update = flag.Bool("update", false, "rewrite the allowlist of the known failures")
+
+// specs are the spec examples, by name: commonmark.json is the spec.json of CommonMark 0.31.2,
+// gfm.json holds the examples of the GFM extensions in the same format
+var specs = []struct {
+	name string
+	path string
+}{
+	{name: "commonmark", path: "testdata/commonmark.json"},
+	{name: "gfm", path: "testdata/gfm.json"},
+}
+
+func TestSpec(t *testing.T) {
+	allowlist, err := LoadAllowlist(allowlistPath)
+	if !*update && !assert.NoError(t, err) {
+		return
+	}
+
+	updated := Allowlist{}
+	for _, spec := range specs {
+		examples, err := LoadExamples(spec.path)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		for _, backend := range []string{mdparser.BackendBlackfriday, mdparser.BackendGoldmark} {
+			config := mdparser.NewConfig(mdparser.WithBackend(backend))
+			checks := []Check{RoundTrip(config), JSON(config)}
+			if backend == mdparser.BackendBlackfriday {
+				// The markdown renderer only supports blackfriday, it warns about another backend
+				checks = append(checks, Renderer(config))
+			}
+
+			t.Run(spec.name+"/"+backend, func(t *testing.T) {
+				report := Run(examples, checks)
+				t.Logf("pass rates by section:\n%s", report)
+
+				for _, check := range report.Checks {
+					key := spec.name + "/" + backend + "/" + check
+					failures := report.Failures(check)
+					updated[key] = failures
+					if *update {
+						continue
+					}
+
+					unexpected, fixed := allowlist.Compare(key, failures)
+					for _, result := range report.Results {
+						if result.Check == check && result.Err != nil && slices.Contains(unexpected, result.Example.Example) {
+							t.Errorf("%s: example %d (%s) fails: %v", key, result.Example.Example, result.Example.Section, result.Err)
+						}
+					}
+					assert.Empty(t, fixed, "%s: the known failures pass, remove them from %s", key, allowlistPath)
+				}
+			})
+		}
+	}
+
+	if *update {
+		assert.NoError(t, updated.Save(allowlistPath))
+	}
+}
+
+func TestReference(t *testing.T) {
+	// The reference renderer renders the HTML of the spec, the failures of the other checks are not
+	// due to the reference renderer or the HTML comparison
+	for _, spec := range specs {
+		examples, err := LoadExamples(spec.path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		report := Run(examples, []Check{Reference()})
+		assert.Empty(t, report.Failures("reference"), spec.name)
+	}
+}
+
+func TestReport(t *testing.T) {
+	pass := Check{Name: "pass", Run: func(example Example) error { return nil }}
+	odd := Check{Name: "odd", Run: func(example Example) error {
+		if example.Example%2 == 1 {
+			panic("odd example")
+		}
+		return nil
+	}}
+	report := Run([]Example{
+		{Example: 1, Section: "Tabs"},
+		{Example: 2, Section: "Tabs"},
+		{Example: 3, Section: "Links"},
+	}, []Check{pass, odd})
+
+	assert.Equal(t, []int{1, 3}, report.Failures("odd"))
+	assert.Equal(t, []SectionStats{
+		{Section: "Tabs", Check: "pass", Passed: 2, Total: 2},
+		{Section: "Tabs", Check: "odd", Passed: 1, Total: 2},
+		{Section: "Links", Check: "pass", Passed: 1, Total: 1},
+		{Section: "Links", Check: "odd", Passed: 0, Total: 1},
+	}, report.Sections())
+	assert.Equal(t, "Section  pass        odd\n"+
+		"Tabs     2/2 (100%)  1/2 (50%)\n"+
+		"Links    1/1 (100%)  0/1 (0%)\n"+
+		"Total    3/3 (100%)  1/3 (33%)\n", report.String())
+
+	unexpected, fixed := Allowlist{"spec/odd": {3, 5}}.Compare("spec/odd", report.Failures("odd"))
+	assert.Equal(t, []int{1}, unexpected)
+	assert.Equal(t, []int{5}, fixed)
+}
@@ -0,0 +1,250 @@
+package mdtojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	ordered "github.com/stencilframe/mdtools/libs/ordered_map"
+)
+
+// ContainerJSONTable is the container the chunker writes tables into
+const ContainerJSONTable = "json_table"
+
+// The placeholder paragraph stands for a container block in the markdown given to the parser.
+// It is delimited by U+E000, a private use character which mdparser.ReplaceReserved removes from the document text.
+const (
+	containerPlaceholder    = "\uE000container:"
+	containerPlaceholderEnd = "\uE000"
+)
+
+// containerOpenRe matches the opening fence of a container block, such as
+// :::note, :::details Click to expand or :::warning[Title]{#id .class key=value}
+var containerOpenRe = regexp.MustCompile(`^ {0,3}(:{3,})[ \t]*([A-Za-z][\w-]*)(?:\[([^\]]*)\])?(?:\{([^}]*)\})?[ \t]*(.*?)[ \t]*$`)
+
+// containerCloseRe matches the closing fence of a container block
+var containerCloseRe = regexp.MustCompile(`^ {0,3}(:{3,})[ \t]*$`)
+
+// containerAttributeRe matches the attributes of a container: #id, .class, key=value or key
+var containerAttributeRe = regexp.MustCompile(`([#.]?)([\w-]+)(?:=(?:"([^"]*)"|'([^']*)'|([^\s"']+)))?`)
+
+// container is a container block extracted from the markdown before parsing
+type container struct {
+	name       string
+	title      string
+	attributes map[string]string
+	fence      int          // Length of the opening fence
+	body       bytes.Buffer // Content, the nested containers being replaced by their placeholders
+}
+
+// extractContainers replaces the container blocks of the markdown with placeholders,
+// storing their content to be parsed separately. The nested containers are extracted
+// in the same pass, their placeholders are left in the body of their parent, so that
+// every line of the document is scanned and parsed once.
+func (r *JSONRenderer) extractContainers(markdownData []byte) []byte {
+	var output bytes.Buffer
+	open := []*container{} // Open containers, innermost last
+
+	// body returns the buffer of the innermost open container, or of the document
+	body := func() *bytes.Buffer {
+		if len(open) == 0 {
+			return &output
+		}
+		return &open[len(open)-1].body
+	}
+
+	for _, line := range mdparser.SplitLines(markdownData) {
+		text := strings.TrimRight(line.Text, "\r\n")
+
+		// Container syntax is literal inside code blocks
+		switch {
+		case line.Code:
+		case containerOpenRe.MatchString(text):
+			match := containerOpenRe.FindStringSubmatch(text)
+			title := match[3]
+			if title == "" {
+				title = match[5]
+			}
+			open = append(open, &container{
+				name:       match[2],
+				title:      title,
+				attributes: parseContainerAttributes(match[4]),
+				fence:      len(match[1]),
+			})
+			continue
+		case len(open) > 0 && containerCloseRe.MatchString(text):
+			fence := len(containerCloseRe.FindStringSubmatch(text)[1])
+			if fence >= open[len(open)-1].fence {
+				c := open[len(open)-1]
+				open = open[:len(open)-1]
+				r.addContainer(body(), c)
+				continue
+			}
+		}
+		body().WriteString(line.Text)
+	}
+
+	// Unclosed containers run to the end of the document
+	for len(open) > 0 {
+		c := open[len(open)-1]
+		open = open[:len(open)-1]
+		r.addContainer(body(), c)
+	}
+	return output.Bytes()
+}
+
+// addContainer stores a container and writes its placeholder paragraph
+func (r *JSONRenderer) addContainer(output *bytes.Buffer, c *container) {
+	r.containers = append(r.containers, c)
+	output.WriteString("\n" + containerPlaceholder + strconv.Itoa(len(r.containers)-1) + containerPlaceholderEnd + "\n\n")
+}
+
+// parseContainerAttributes parses the {#id .class key=value} attributes of a container
+func parseContainerAttributes(text string) map[string]string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	attributes := map[string]string{}
+	for _, match := range containerAttributeRe.FindAllStringSubmatch(text, -1) {
+		switch match[1] {
+		case "#":
+			attributes["id"] = match[2]
+		case ".":
+			attributes["class"] = strings.TrimSpace(attributes["class"] + " " + match[2])
+		default:
+			attributes[match[2]] = match[3] + match[4] + match[5]
+		}
+	}
+	return attributes
+}
+
+// handlePlaceholder returns the block a placeholder paragraph stands for,
+// a container, a math block or an embed
+func (r *JSONRenderer) handlePlaceholder(node *mdparser.Node) (Node, bool) {
+	if container, ok := r.handleContainer(node); ok {
+		return container, true
+	}
+	if math, ok := r.handleMathBlock(node); ok {
+		return math, true
+	}
+	return r.handleEmbed(node)
+}
+
+// handleContainer returns the container a placeholder paragraph stands for
+func (r *JSONRenderer) handleContainer(node *mdparser.Node) (Node, bool) {
+	if node.Type != mdparser.Paragraph || node.FirstChild == nil || node.FirstChild != node.LastChild {
+		return nil, false
+	}
+	literal := string(node.FirstChild.Literal)
+	if !strings.HasPrefix(literal, containerPlaceholder) {
+		return nil, false
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(literal, containerPlaceholder), containerPlaceholderEnd))
+	if err != nil || index < 0 || index >= len(r.containers) {
+		return nil, false
+	}
+	c := r.containers[index]
+
+	if c.name == ContainerJSONTable {
+		table, err := parseJSONTable(c.body.Bytes())
+		if err == nil {
+			r.limitTable(table.(*TableNode))
+			return table, true
+		}
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningContainer, "container %q: %v", c.name, err))
+	}
+
+	// The blocks of the container are nested in place of the placeholder
+	depth := r.depth
+	for n := node.Parent; n != nil; n = n.Parent {
+		r.depth++
+	}
+	defer func() { r.depth = depth }()
+	return NewContainerNode(c.name, c.title, c.attributes, r.parseBlocks(c.body.Bytes())), true
+}
+
+// parseBlocks parses the markdown content of a container into block nodes,
+// its nested containers are already replaced by their placeholders
+func (r *JSONRenderer) parseBlocks(markdownData []byte) []Node {
+	document := r.parseTree(markdownData)
+
+	children := []Node{}
+	for n := document.FirstChild; n != nil; n = n.Next {
+		if n.Type == mdparser.List && n.IsFootnotesList {
+			// Footnotes are defined at the document level
+			continue
+		}
+		if child := r.handleBlock(n); child != nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// parseJSONTable parses the JSON data of a json_table container back into a table.
+// Chunked tables keep a trailing comma after their last row.
+func parseJSONTable(data []byte) (Node, error) {
+	data = removeTrailingCommas(bytes.TrimSpace(data))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty table")
+	}
+
+	switch data[0] {
+	case '[':
+		var raw []json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON table: %w", err)
+		}
+		// The ordered maps must be initialized before decoding
+		rows := []*ordered.OrderedMap{}
+		for _, r := range raw {
+			row := ordered.NewOrderedMap()
+			if err := row.UnmarshalJSON(r); err != nil {
+				return nil, fmt.Errorf("invalid JSON table row: %w", err)
+			}
+			rows = append(rows, row)
+		}
+		return NewTableNode(rows), nil
+	case '{':
+		rows := ordered.NewOrderedMap()
+		if err := rows.UnmarshalJSON(data); err != nil {
+			return nil, fmt.Errorf("invalid JSON table: %w", err)
+		}
+		return NewTableNode(rows), nil
+	}
+	return nil, fmt.Errorf("invalid JSON table: expected an array or an object")
+}
+
+// removeTrailingCommas removes the commas before the closing brackets, outside of the strings
+func removeTrailingCommas(data []byte) []byte {
+	output := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			next := bytes.TrimLeft(data[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == ']' || next[0] == '}') {
+				continue
+			}
+		}
+		output = append(output, c)
+	}
+	return output
+}
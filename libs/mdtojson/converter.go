@@ -0,0 +1,23 @@
+package mdtojson
+
+import (
+	"context"
+	"slices"
+)
+
+// Converter converts markdown documents into JSON nodes. It is configured once and holds
+// no state of the documents, each conversion runs on a fresh JSONRenderer, so that a Converter
+// can be shared between goroutines. The parser configuration must not be modified afterwards.
+type Converter struct {
+	options []Option
+}
+
+// NewConverter creates a converter with the options of the JSON renderer
+func NewConverter(options ...Option) *Converter {
+	return &Converter{options: slices.Clone(options)}
+}
+
+// Convert converts the markdown data into JSON nodes, see JSONRenderer.Convert
+func (c *Converter) Convert(ctx context.Context, markdownData []byte) (Result, error) {
+	return NewJSONRenderer(c.options...).Convert(ctx, markdownData)
+}
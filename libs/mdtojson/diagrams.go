@@ -0,0 +1,230 @@
+package mdtojson
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+)
+
+// Languages of the fenced code blocks holding diagram sources
+var diagramLanguages = map[string]bool{
+	"mermaid":  true,
+	"plantuml": true,
+	"puml":     true,
+	"dot":      true,
+	"graphviz": true,
+}
+
+// Mermaid diagram kinds the labels and edges are extracted from
+const (
+	DiagramKindFlowchart = "flowchart"
+	DiagramKindSequence  = "sequence"
+)
+
+// DiagramGraph holds the labels and edges extracted from a diagram source
+type DiagramGraph struct {
+	Kind  string         `json:"kind"`
+	Nodes []DiagramLabel `json:"nodes"`
+	Edges []DiagramEdge  `json:"edges"`
+}
+
+// DiagramLabel is a node of a diagram, or a participant of a sequence diagram
+type DiagramLabel struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// DiagramEdge is a link between two nodes, or a message of a sequence diagram
+type DiagramEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+var (
+	// mermaidLinkRe matches the flowchart links: A --> B, A -->|label| B, A -- label --> B, A -.-> B, A ==> B
+	mermaidLinkRe = regexp.MustCompile(`\s*(?:<?(?:--|==|-\.)\s+([^|>]+?)\s+)?<?(?:-{2,}|={2,}|-\.+-|\.-+|~{3,})[>ox]?(?:\|([^|]*)\|)?\s*`)
+	// mermaidNodeRe matches a flowchart node with its optional shape, label and class: A, A[Label], A((Label)):::class
+	mermaidNodeRe = regexp.MustCompile(`^([\w-]+)(?::::[\w-]+)?\s*(?:(\[\[|\[\(|\(\[|\(\(|\{\{|\[/|\[\\|\[|\(|\{|>)(.*?)(\]\]|\)\]|\]\)|\)\)|\}\}|/\]|\\\]|\]|\)|\}))?(?::::[\w-]+)?$`)
+	// mermaidMessageRe matches a sequence diagram message: Alice->>Bob: Hello
+	mermaidMessageRe = regexp.MustCompile(`^([^\s:>-]+)\s*(?:--?>>|--?>|--?x|--?\))\s*[+-]?\s*([^\s:]+)\s*:\s*(.*)$`)
+	// mermaidParticipantRe matches a sequence diagram participant: participant A as Alice
+	mermaidParticipantRe = regexp.MustCompile(`^(?:participant|actor)\s+(\S+)(?:\s+as\s+(.+))?$`)
+)
+
+// diagramLanguage returns the language of a code block info string, without its attributes
+func diagramLanguage(info string) string {
+	if fields := strings.Fields(info); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// isDiagram checks if the info string of a code block is a diagram language
+func isDiagram(info string) bool {
+	return diagramLanguages[strings.ToLower(diagramLanguage(info))]
+}
+
+// newCodeBlockNode creates a code block node, or a diagram node for the diagram languages
+func (r *JSONRenderer) newCodeBlockNode(node *mdparser.Node) Node {
+	language := string(node.CodeBlockData.Info)
+	code := r.restoreCode(string(node.Literal))
+	if isDiagram(language) {
+		return NewDiagramNode(language, code)
+	}
+	return NewCodeBlockNode(language, code)
+}
+
+// ParseMermaid extracts the labels and edges of a mermaid flowchart or sequence diagram.
+// It returns nil for the other kinds of diagrams.
+func ParseMermaid(code string) *DiagramGraph {
+	statements := []string{}
+	for _, line := range strings.Split(code, "\n") {
+		for _, statement := range strings.Split(line, ";") {
+			statement = strings.TrimSpace(statement)
+			if statement != "" && !strings.HasPrefix(statement, "%%") {
+				statements = append(statements, statement)
+			}
+		}
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	header := strings.Fields(statements[0])[0]
+	graph := &diagramBuilder{labels: map[string]int{}}
+	switch header {
+	case "flowchart", "graph":
+		graph.Kind = DiagramKindFlowchart
+		for _, statement := range statements[1:] {
+			graph.parseFlowchartStatement(statement)
+		}
+	case "sequenceDiagram":
+		graph.Kind = DiagramKindSequence
+		for _, statement := range statements[1:] {
+			graph.parseSequenceStatement(statement)
+		}
+	default:
+		return nil
+	}
+	return &graph.DiagramGraph
+}
+
+// diagramBuilder collects the nodes of a diagram in order of first appearance
+type diagramBuilder struct {
+	DiagramGraph
+
+	labels map[string]int // Index of the nodes by ID
+}
+
+// addNode registers a node, the first explicit label wins
+func (b *diagramBuilder) addNode(id, label string) {
+	label = strings.Trim(strings.TrimSpace(label), `"`)
+	index, ok := b.labels[id]
+	if !ok {
+		b.labels[id] = len(b.Nodes)
+		if label == "" {
+			label = id
+		}
+		b.Nodes = append(b.Nodes, DiagramLabel{ID: id, Label: label})
+		return
+	}
+	if label != "" && b.Nodes[index].Label == id {
+		b.Nodes[index].Label = label
+	}
+}
+
+// parseFlowchartStatement parses the nodes and links of a flowchart statement
+func (b *diagramBuilder) parseFlowchartStatement(statement string) {
+	keyword := strings.Fields(statement)[0]
+	switch keyword {
+	case "subgraph", "end", "direction", "classDef", "class", "style", "linkStyle", "click":
+		return
+	}
+
+	// The statement alternates node groups and links: A & B --> C -->|label| D
+	groups := [][]string{}
+	labels := []string{}
+	last := 0
+	for _, loc := range mermaidLinkRe.FindAllStringSubmatchIndex(statement, -1) {
+		groups = append(groups, b.parseFlowchartNodes(statement[last:loc[0]]))
+		label := ""
+		for _, group := range []int{2, 4} {
+			if loc[group] >= 0 {
+				label = strings.TrimSpace(statement[loc[group]:loc[group+1]])
+			}
+		}
+		labels = append(labels, strings.Trim(label, `"`))
+		last = loc[1]
+	}
+	groups = append(groups, b.parseFlowchartNodes(statement[last:]))
+
+	for i, label := range labels {
+		for _, from := range groups[i] {
+			for _, to := range groups[i+1] {
+				b.Edges = append(b.Edges, DiagramEdge{From: from, To: to, Label: label})
+			}
+		}
+	}
+}
+
+// parseFlowchartNodes parses a group of nodes separated by &, returning their IDs
+func (b *diagramBuilder) parseFlowchartNodes(text string) []string {
+	ids := []string{}
+	for _, part := range strings.Split(text, "&") {
+		match := mermaidNodeRe.FindStringSubmatch(strings.TrimSpace(part))
+		if match == nil {
+			continue
+		}
+		b.addNode(match[1], match[3])
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+// parseSequenceStatement parses the participants and messages of a sequence diagram statement
+func (b *diagramBuilder) parseSequenceStatement(statement string) {
+	if match := mermaidParticipantRe.FindStringSubmatch(statement); match != nil {
+		b.addNode(match[1], match[2])
+		return
+	}
+	if match := mermaidMessageRe.FindStringSubmatch(statement); match != nil {
+		b.addNode(match[1], "")
+		b.addNode(match[2], "")
+		b.Edges = append(b.Edges, DiagramEdge{From: match[1], To: match[2], Label: strings.TrimSpace(match[3])})
+	}
+}
+
+// Summary describes the diagram in text, with the labels and edges when they are known
+func (n *DiagramNode) Summary() string {
+	var sb strings.Builder
+	kind := diagramLanguage(n.Language)
+	if n.Graph != nil {
+		kind += " " + n.Graph.Kind
+	}
+	sb.WriteString("[Diagram: " + kind + "]\n")
+
+	if n.Graph != nil {
+		labels := map[string]string{}
+		for _, node := range n.Graph.Nodes {
+			labels[node.ID] = node.Label
+		}
+		linked := map[string]bool{}
+		for _, edge := range n.Graph.Edges {
+			linked[edge.From], linked[edge.To] = true, true
+			sb.WriteString("- " + labels[edge.From] + " -> " + labels[edge.To])
+			if edge.Label != "" {
+				sb.WriteString(": " + edge.Label)
+			}
+			sb.WriteString("\n")
+		}
+		// Nodes without edges are listed on their own
+		for _, node := range n.Graph.Nodes {
+			if !linked[node.ID] {
+				sb.WriteString("- " + node.Label + "\n")
+			}
+		}
+	}
+	return sb.String() + "\n"
+}
@@ -0,0 +1,291 @@
+package mdtojson
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF for image.DecodeConfig
+	_ "image/jpeg" // Register JPEG for image.DecodeConfig
+	_ "image/png"  // Register PNG for image.DecodeConfig
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+)
+
+// File extensions of the extracted data URI images by MIME type
+var imageExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/jpg":     ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+	"image/bmp":     ".bmp",
+	"image/tiff":    ".tiff",
+	"image/x-icon":  ".ico",
+	"image/avif":    ".avif",
+}
+
+// DataURIExtraction configures the extraction of data URI images to files
+type DataURIExtraction struct {
+	Dir       string // Output directory of the extracted images
+	URLPrefix string // Prefix of the rewritten image URLs, defaults to Dir
+	MaxBytes  int64  // Maximum decoded size of an image, 0 means no limit
+}
+
+// ImageResolution configures the resolution of relative image URLs.
+// Local files are checked relative to BaseDir, the paths leading outside of it are rejected;
+// the image URL is rewritten against BaseURL when set, or to the local path otherwise.
+type ImageResolution struct {
+	BaseDir string // Directory of the source file
+	BaseURL string // Base URL of the published images
+}
+
+// ImageRef describes an image referenced in the document.
+// Images are numbered in the order of their first occurrence.
+type ImageRef struct {
+	Reference int    `json:"reference"`          // Reference number used by {IMG:n}
+	URL       string `json:"url"`                // Image URL
+	Alt       string `json:"alt"`                // Alt text of the first occurrence
+	Title     string `json:"title,omitempty"`    // Title of the first occurrence
+	MIMEType  string `json:"mimeType,omitempty"` // MIME type, when known
+	Width     int    `json:"width,omitempty"`    // Width in pixels, when known
+	Height    int    `json:"height,omitempty"`   // Height in pixels, when known
+	Count     int    `json:"count"`              // Number of occurrences in the document
+}
+
+// NewImageRef creates a new image reference from an image node
+func NewImageRef(reference int, image *ImageNode) *ImageRef {
+	mimeType := image.MIMEType
+	if mimeType == "" {
+		mimeType = dataURIMIMEType(image.URL)
+	}
+	return &ImageRef{
+		Reference: reference,
+		URL:       image.URL,
+		Alt:       image.Alt,
+		Title:     image.Title,
+		MIMEType:  mimeType,
+		Width:     image.Width,
+		Height:    image.Height,
+		Count:     1,
+	}
+}
+
+// ToReference returns the {IMG:n} placeholder of the image
+func (ref *ImageRef) ToReference() string {
+	return fmt.Sprintf("{IMG:%d}", ref.Reference)
+}
+
+// isDataURI checks if the url is a data URI (e.g. data:image/png;base64,...)
+func isDataURI(uri string) bool {
+	return len(uri) > 5 && uri[:5] == "data:"
+}
+
+// dataURIMIMEType returns the media type of a data URI, or an empty string
+func dataURIMIMEType(uri string) string {
+	if !isDataURI(uri) {
+		return ""
+	}
+	header, _, found := strings.Cut(uri[5:], ",")
+	if !found {
+		return ""
+	}
+	mimeType, _, _ := strings.Cut(header, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// decodeDataURI decodes the payload of a data URI
+func decodeDataURI(uri string) (mimeType string, data []byte, err error) {
+	header, payload, found := strings.Cut(uri[5:], ",")
+	if !found {
+		return "", nil, fmt.Errorf("malformed data URI")
+	}
+
+	mimeType = dataURIMIMEType(uri)
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		// Base64 payloads are often wrapped or padded inconsistently
+		payload = strings.Join(strings.Fields(payload), "")
+		data, err = base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+	} else {
+		var unescaped string
+		unescaped, err = url.PathUnescape(payload)
+		data = []byte(unescaped)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid data URI payload: %w", err)
+	}
+	return mimeType, data, nil
+}
+
+// limitDataURI drops a data URI image over the size limit of the configuration
+func (r *JSONRenderer) limitDataURI(image *ImageNode) {
+	limit := r.config.Limits.MaxDataURIBytes
+	if limit <= 0 || !isDataURI(image.URL) || len(image.URL) <= limit {
+		return
+	}
+	r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningLimit, "image %q: data URI of %d bytes exceeds the limit of %d bytes", image.Alt, len(image.URL), limit))
+	image.MIMEType = dataURIMIMEType(image.URL)
+	image.URL = ""
+	image.Dropped = true
+}
+
+// extractDataURI writes a data URI image to the output directory under
+// a content-hashed name, and rewrites the image to point at the file
+func (r *JSONRenderer) extractDataURI(image *ImageNode) {
+	if image.Dropped || !isDataURI(image.URL) {
+		return
+	}
+	config := r.dataURIExtraction
+
+	mimeType, data, err := decodeDataURI(image.URL)
+	if err != nil {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "image %q: %v", image.Alt, err))
+		return
+	}
+
+	// Drop images over the size cap rather than carrying them inline
+	if config.MaxBytes > 0 && int64(len(data)) > config.MaxBytes {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "image %q: data URI of %d bytes exceeds the limit of %d bytes", image.Alt, len(data), config.MaxBytes))
+		image.URL = ""
+		image.MIMEType = mimeType
+		image.Dropped = true
+		return
+	}
+
+	ext, ok := imageExtensions[mimeType]
+	if !ok {
+		ext = ".bin"
+	}
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ext
+
+	// Identical images share the same file
+	if err := writeImageFile(config.Dir, name, data); err != nil {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "image %q: %v", image.Alt, err))
+		return
+	}
+
+	if config.URLPrefix != "" {
+		image.URL = strings.TrimRight(config.URLPrefix, "/") + "/" + name
+	} else {
+		image.URL = path.Join(filepath.ToSlash(config.Dir), name)
+	}
+	image.MIMEType = mimeType
+}
+
+// writeImageFile writes the data of an image to the named file of the directory, unless the file
+// already holds it. The data is written to a temporary file renamed into place, so that the conversions
+// sharing a Converter never see a partially written file.
+func writeImageFile(dir, name string, data []byte) (err error) {
+	filePath := filepath.Join(dir, name)
+	if info, err := os.Stat(filePath); err == nil && info.Mode().IsRegular() && info.Size() == int64(len(data)) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
+
+// resolveImage resolves a relative image URL against the configured base,
+// checks the local file exists and records its MIME type and dimensions
+func (r *JSONRenderer) resolveImage(image *ImageNode) {
+	config := r.imageResolution
+
+	ref, err := url.Parse(image.URL)
+	if err != nil || image.URL == "" || ref.Scheme != "" || ref.Host != "" {
+		// Absolute URLs, data URIs and unparsable URLs are left untouched
+		return
+	}
+
+	if config.BaseDir != "" {
+		// The images are looked up inside the base directory only, the documents may be untrusted
+		localPath, ok := mdparser.LocalPath(config.BaseDir, ref.Path)
+		if !ok {
+			r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "image %q: %q is outside of the base directory", image.Alt, image.URL))
+			return
+		}
+		if err := image.sniffFile(localPath); err != nil {
+			r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "image %q: broken reference %q: %v", image.Alt, image.URL, err))
+		}
+		if config.BaseURL == "" {
+			// The query and the fragment, such as the #width=100 hints, are kept
+			local := &url.URL{Path: filepath.ToSlash(localPath), RawQuery: ref.RawQuery, Fragment: ref.Fragment, RawFragment: ref.RawFragment}
+			image.URL = local.String()
+		}
+	}
+
+	if config.BaseURL != "" {
+		base, err := url.Parse(config.BaseURL)
+		if err != nil {
+			r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningImage, "invalid image base URL %q: %v", config.BaseURL, err))
+			return
+		}
+		image.URL = base.ResolveReference(ref).String()
+	}
+}
+
+// sniffFile records the MIME type and dimensions of a local image file
+// by reading its header bytes. Only the regular files are read, a FIFO or a device could block.
+func (n *ImageNode) sniffFile(filePath string) error {
+	f, err := mdparser.OpenRegular(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	size, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	header = header[:size]
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(header), ";")
+	if strings.EqualFold(filepath.Ext(filePath), ".svg") {
+		mimeType = "image/svg+xml"
+	}
+	n.MIMEType = mimeType
+
+	// Dimensions are only known for the registered raster formats
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if config, _, err := image.DecodeConfig(f); err == nil {
+		n.Width = config.Width
+		n.Height = config.Height
+	}
+	return nil
+}
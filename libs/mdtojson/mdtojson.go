@@ -1,89 +1,177 @@
 package mdtojson
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
 
-	"github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdmath"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 	ordered "github.com/stencilframe/mdtools/libs/ordered_map"
+	"github.com/stencilframe/mdtools/libs/orderedmap"
 )
 
 type (
-	// Custom JSON Renderer
+	// Custom JSON Renderer, it converts one document at a time: use a Converter to convert
+	// several documents from several goroutines
 	JSONRenderer struct {
-		nodes         []Node         // Root-level nodes
-		headerStack   []*HeadingNode // Stack to manage nested headers
-		currentHeader *HeadingNode   // Current header node
-		imageRefs     []Node         // Stores image references (e.g., [1]: <image>, [2]: <image>)
+		nodes         []Node                  // Root-level nodes
+		headerStack   []*HeadingNode          // Stack to manage nested headers
+		currentHeader *HeadingNode            // Current header node
+		imageRefs     []*ImageRef             // Stores image references (e.g., [1]: <image>, [2]: <image>)
+		imageIndex    map[string]int          // Positions of the image references in imageRefs by URL
+		warnings      []mdparser.Warning      // Non-fatal problems found during the conversion
+		err           error                   // Error of RenderFooter, returned by Err
+		footnotes     map[string]int          // Footnote numbers by label, in order of first reference
+		slugger       *Slugger                // Generates the unique heading IDs
+		headingIDs    map[string]*HeadingNode // Headings by ID, targets of the anchor links
+		anchorLinks   []*LinkNode             // In-document #anchor links, resolved once all headings are known
+		finished      bool                    // The sections are closed and the anchor links resolved
+		containers    []*container            // Container blocks replaced by placeholders before parsing
+		math          mdmath.Spans            // Math spans replaced by placeholders before parsing
+		wikiLinkRefs  []*wikiLink             // Wiki links replaced by placeholders before parsing
+		abbreviations *mdparser.Abbreviations // Abbreviations defined in the document
+		references    []mdparser.Reference    // Reference definitions of the document, shared with the container bodies
+		depth         int                     // Depth of the syntax tree being converted, below the document in the container bodies
+		budget        mdparser.NodeBudget     // Nodes of the syntax trees of the document and its container bodies
+		ctx           context.Context         // Context of the conversion, checked between the blocks
+
+		config            *mdparser.Config   // Configuration of the markdown parser
+		dataURIExtraction *DataURIExtraction // Extract data URI images to files when set
+		imageResolution   *ImageResolution   // Resolve relative image URLs when set
+		wikiLinks         *WikiLinks         // Parse the wiki links and embeds when set
 	}
 )
 
-// NewJSONRenderer creates a new JSONRenderer instance
-func NewJSONRenderer() *JSONRenderer {
-	return &JSONRenderer{
-		imageRefs: []Node{},
+// Option defines the functional option type
+type Option func(r *JSONRenderer)
+
+// WithParserConfig sets the configuration of the markdown parser
+func WithParserConfig(config *mdparser.Config) Option {
+	return func(r *JSONRenderer) {
+		r.config = config
+	}
+}
+
+// WithDataURIExtraction decodes data URI images and writes them to files
+func WithDataURIExtraction(config DataURIExtraction) Option {
+	return func(r *JSONRenderer) {
+		r.dataURIExtraction = &config
+	}
+}
+
+// WithImageResolution resolves and validates relative image URLs
+func WithImageResolution(config ImageResolution) Option {
+	return func(r *JSONRenderer) {
+		r.imageResolution = &config
+	}
+}
+
+// NewJSONRenderer creates a new JSONRenderer instance, parsing within mdparser.DefaultLimits
+// unless WithParserConfig sets other limits
+func NewJSONRenderer(options ...Option) *JSONRenderer {
+	r := &JSONRenderer{
+		config: mdparser.NewConfig(),
+	}
+	r.reset()
+	for _, option := range options {
+		option(r)
 	}
+	return r
+}
+
+// reset clears the state of the previous document, the options are kept
+func (r *JSONRenderer) reset() {
+	r.nodes = nil
+	r.headerStack = nil
+	r.currentHeader = nil
+	r.imageRefs = []*ImageRef{}
+	r.imageIndex = map[string]int{}
+	r.warnings = nil
+	r.err = nil
+	r.footnotes = map[string]int{}
+	r.slugger = NewSlugger()
+	r.headingIDs = map[string]*HeadingNode{}
+	r.anchorLinks = nil
+	r.finished = false
+	r.containers = nil
+	r.math = nil
+	r.wikiLinkRefs = nil
+	r.abbreviations = nil
+	r.references = nil
+	r.depth = 0
+	r.budget = mdparser.NodeBudget{}
 }
 
 // RenderNode processes each node and converts it to a JSON-friendly structure
-func (r *JSONRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+func (r *JSONRenderer) RenderNode(w io.Writer, node *mdparser.Node, entering bool) mdparser.WalkStatus {
 	if entering {
+		// Check the context between the top-level blocks
+		if node.Parent != nil && node.Parent.Type == mdparser.Document {
+			r.checkContext()
+		}
+
 		var contentNode Node
 		switch node.Type {
-		case blackfriday.Document:
+		case mdparser.Document:
 			// Document is the root node, no specific action needed other than ensuring the document is parsed
-			return blackfriday.GoToNext
+			return mdparser.GoToNext
 
-		case blackfriday.Heading:
+		case mdparser.Heading:
 			r.handleHeader(node)
 
-		case blackfriday.Table:
+		case mdparser.Table:
 			contentNode = r.handleTable(node)
 
-		case blackfriday.List:
+		case mdparser.List:
+			if node.IsFootnotesList {
+				r.handleFootnotes(node)
+				return mdparser.SkipChildren
+			}
 			contentNode = r.handleList(node)
 
-		case blackfriday.Paragraph:
+		case mdparser.Paragraph:
+			if block, ok := r.handlePlaceholder(node); ok {
+				contentNode = block
+				break
+			}
 			contentNode = r.handleParagraph(node)
 
-		case blackfriday.Hardbreak:
+		case mdparser.Hardbreak:
 			contentNode = &BaseNode{
 				Type: NodeTypeLineBreak,
 			}
 
-		case blackfriday.Softbreak:
+		case mdparser.Softbreak:
 			contentNode = &BaseNode{
 				Type: NodeTypeSoftBreak,
 			}
 
-		case blackfriday.HorizontalRule:
+		case mdparser.HorizontalRule:
 			contentNode = &BaseNode{
 				Type: NodeTypeLineSeparator,
 			}
 
-		case blackfriday.BlockQuote:
-			quoteContent := r.extractContent(node)
-			contentNode = &BaseNode{
-				Type:     NodeTypeBlockquote,
-				Children: quoteContent,
-			}
+		case mdparser.BlockQuote:
+			contentNode = r.handleBlockQuote(node)
 
-		case blackfriday.CodeBlock:
-			codeContent := string(node.Literal)
-			language := string(node.Info)
-			contentNode = NewCodeBlockNode(codeContent, language)
+		case mdparser.CodeBlock:
+			contentNode = r.newCodeBlockNode(node)
 
 			// TODO: Implement HTML block and span handling
-			// case blackfriday.HTMLBlock:
+			// case mdparser.HTMLBlock:
 			// 	htmlContent := string(node.Literal)
 			// 	contentNode = &BaseNode{
 			// 		Type:     "html-block",
 			// 		Children: htmlContent,
 			// 	}
 
-			// case blackfriday.HTMLSpan:
+			// case mdparser.HTMLSpan:
 			// 	htmlContent := string(node.Literal)
 			// 	contentNode = &BaseNode{
 			// 		Type:     "html-span",
@@ -99,45 +187,64 @@ func (r *JSONRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering
 			}
 		}
 
-		if node.Type == blackfriday.BlockQuote ||
-			node.Type == blackfriday.Table ||
-			node.Type == blackfriday.List {
-			return blackfriday.SkipChildren
+		if node.Type == mdparser.BlockQuote ||
+			node.Type == mdparser.Table ||
+			node.Type == mdparser.List {
+			return mdparser.SkipChildren
 		}
 	}
-	return blackfriday.GoToNext
+	return mdparser.GoToNext
 }
 
-// RenderHeader is a no-op for this extension, but required by the Renderer interface
-func (r *JSONRenderer) RenderHeader(w io.Writer, ast *blackfriday.Node) {}
+// RenderHeader is called before walking a document, there is nothing to output
+func (r *JSONRenderer) RenderHeader(w io.Writer, ast *mdparser.Node) {}
 
-// RenderFooter is called at the end of processing to finalize the output
-func (r *JSONRenderer) RenderFooter(w io.Writer, ast *blackfriday.Node) {
-	// Finalize and append any remaining headers to the root node
-	r.finalizeHeaders(0)
+// RenderFooter is called at the end of processing to finalize the output.
+// It writes the JSON nodes, a failure to encode or write them is returned by Err.
+func (r *JSONRenderer) RenderFooter(w io.Writer, ast *mdparser.Node) {
+	r.finish()
 
 	// Output the final JSON result
 	output, err := json.MarshalIndent(r.nodes, "", "  ")
 	if err != nil {
-		log.Fatalf("Error generating JSON: %v", err)
+		r.err = fmt.Errorf("generating JSON: %w", err)
+		return
+	}
+	if _, err := w.Write(output); err != nil {
+		r.err = fmt.Errorf("writing JSON: %w", err)
 	}
-	w.Write(output)
+}
+
+// Err returns the error of RenderFooter, nil when the JSON was written
+func (r *JSONRenderer) Err() error {
+	return r.err
 }
 
 // Return nodes
 func (r *JSONRenderer) GetNodes() []Node {
-	// Finalize and append any remaining headers to the root node
-	r.finalizeHeaders(0)
+	r.finish()
 
 	// Return the root nodes
 	return r.nodes
 }
 
+// finish appends the remaining headers to the root nodes and resolves the anchor links,
+// once at the end of the document
+func (r *JSONRenderer) finish() {
+	if r.finished {
+		return
+	}
+	r.finished = true
+
+	r.finalizeHeaders(0)
+	r.currentHeader = nil
+	r.resolveAnchors()
+}
+
 // handleHeader manages the heading elements and finalizes them.
-func (r *JSONRenderer) handleHeader(node *blackfriday.Node) {
+func (r *JSONRenderer) handleHeader(node *mdparser.Node) {
 	level := node.HeadingData.Level
-	headerText := extractText(node) // Extract heading text
-	headerNode := NewHeadingNode(level, headerText).(*HeadingNode)
+	headerNode := r.newHeadingNode(node)
 
 	// Finalize and append any remaining headers
 	r.finalizeHeaders(level)
@@ -149,6 +256,23 @@ func (r *JSONRenderer) handleHeader(node *blackfriday.Node) {
 	r.currentHeader = headerNode
 }
 
+// newHeadingNode creates a heading node and registers its anchor
+func (r *JSONRenderer) newHeadingNode(node *mdparser.Node) *HeadingNode {
+	headerText := r.extractText(node) // Extract heading text
+	headerNode := NewHeadingNode(node.HeadingData.Level, headerText).(*HeadingNode)
+	headerNode.Inline = r.extractInline(node)
+
+	// Explicit {#custom-id} anchors win over the generated slugs
+	if node.HeadingData.HeadingID != "" {
+		headerNode.ID = r.slugger.Reserve(node.HeadingData.HeadingID)
+		headerNode.ExplicitID = true
+	} else {
+		headerNode.ID = r.slugger.Slug(headerText)
+	}
+	r.headingIDs[headerNode.ID] = headerNode
+	return headerNode
+}
+
 // finalizeHeaders handles appending all headers to `r.nodes`
 func (r *JSONRenderer) finalizeHeaders(level int) {
 	// If there's an existing header being processed, finalize and store it in the stack
@@ -181,85 +305,311 @@ func (r *JSONRenderer) finalizeHeaders(level int) {
 	}
 }
 
-// extractText extracts plain text from a node
-func extractText(node *blackfriday.Node) string {
-	var buffer bytes.Buffer
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.Text {
+// extractText extracts plain text from a node, keeping the math source
+func (r *JSONRenderer) extractText(node *mdparser.Node) string {
+	buffer := mdparser.GetBuffer()
+	defer mdparser.PutBuffer(buffer)
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && (n.Type == mdparser.Text || n.Type == mdparser.Code) {
 			buffer.Write(n.Literal)
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
-	return buffer.String()
+	return r.restoreWikiLinks(string(r.math.Restore(buffer.Bytes())))
+}
+
+// restoreCode restores the syntax replaced by placeholders in a code literal,
+// which the pre-pass left in place when it did not tell the code apart
+func (r *JSONRenderer) restoreCode(code string) string {
+	code = r.restoreWikiLinkSource(code)
+	if len(r.math) == 0 {
+		return code
+	}
+	return string(r.math.Restore([]byte(code)))
 }
 
 // extractContent handles text nodes, links, images, and inline elements.
-func (r *JSONRenderer) extractContent(node *blackfriday.Node) []Node {
+func (r *JSONRenderer) extractContent(node *mdparser.Node) []Node {
 	children := []Node{}
 
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
 		if entering {
 			switch n.Type {
-			case blackfriday.Text:
-				content := extractText(n)
-				if content == "" {
-					return blackfriday.GoToNext
-				}
-				item := NewTextNode(content)
-				children = append(children, item)
-			case blackfriday.List:
-				return blackfriday.SkipChildren
-			case blackfriday.Link:
-				linkUrl := string(n.LinkData.Destination)
-				link := NewLinkNode(linkUrl, extractText(n))
-				children = append(children, link)
-				return blackfriday.SkipChildren
-			case blackfriday.Image:
-				image := NewImageNode(string(n.LinkData.Destination), extractText(n))
-				ref := r.addImage(image)
-				// Update the image reference
-				image.(*ImageNode).Reference = ref
-				children = append(children, image)
-				return blackfriday.SkipChildren
-			case blackfriday.Code:
-				codeContent := string(n.Literal)
+			case mdparser.Text:
+				children = append(children, r.newTextNodes(string(n.Literal))...)
+			case mdparser.List:
+				return mdparser.SkipChildren
+			case mdparser.Link:
+				children = append(children, r.newLinkNode(n))
+				return mdparser.SkipChildren
+			case mdparser.Image:
+				children = append(children, r.newImageNode(n))
+				return mdparser.SkipChildren
+			case mdparser.Code:
+				codeContent := r.restoreCode(string(n.Literal))
 				code := NewCodeNode(codeContent)
 				children = append(children, code)
-			case blackfriday.CodeBlock:
-				codeContent := string(n.Literal)
-				language := string(n.CodeBlockData.Info)
-				codeBlock := NewCodeBlockNode(language, codeContent)
-				children = append(children, codeBlock)
-			case blackfriday.BlockQuote:
-				content := extractText(n)
-				item := NewTextNode(content)
-				children = append(children, item)
-				return blackfriday.SkipChildren
+			case mdparser.CodeBlock:
+				children = append(children, r.newCodeBlockNode(n))
+			case mdparser.BlockQuote:
+				children = append(children, r.handleBlockQuote(n))
+				return mdparser.SkipChildren
 			}
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 
 	return children
 }
 
+// newTextNodes splits a text into text, math and wiki link nodes
+func (r *JSONRenderer) newTextNodes(text string) []Node {
+	nodes := []Node{}
+	last := 0
+	for _, loc := range wikiLinkPlaceholderRe.FindAllStringIndex(text, -1) {
+		link := r.wikiLink(text[loc[0]:loc[1]])
+		if link == nil {
+			continue
+		}
+		nodes = append(nodes, r.newMathTextNodes(text[last:loc[0]])...)
+		nodes = append(nodes, r.newWikiLinkNode(link))
+		last = loc[1]
+	}
+	return append(nodes, r.newMathTextNodes(text[last:])...)
+}
+
+// newMathTextNodes splits a text into text and math nodes
+func (r *JSONRenderer) newMathTextNodes(text string) []Node {
+	nodes := []Node{}
+	for _, part := range r.math.Split(text) {
+		if part.Span != nil {
+			nodes = append(nodes, NewMathNode(part.Span.Math, part.Span.Display))
+		} else if part.Text != "" {
+			nodes = append(nodes, r.newAbbreviationTextNodes(part.Text)...)
+		}
+	}
+	return nodes
+}
+
+// newAbbreviationTextNodes splits a text into text and abbreviation nodes
+func (r *JSONRenderer) newAbbreviationTextNodes(text string) []Node {
+	nodes := []Node{}
+	for _, part := range r.abbreviations.Split(text) {
+		if part.Abbreviation != nil {
+			nodes = append(nodes, NewAbbreviationNode(part.Abbreviation.Abbr, part.Abbreviation.Title))
+		} else if part.Text != "" {
+			nodes = append(nodes, NewTextNode(part.Text))
+		}
+	}
+	return nodes
+}
+
+// handleMathBlock returns the math block a placeholder paragraph stands for
+func (r *JSONRenderer) handleMathBlock(node *mdparser.Node) (Node, bool) {
+	if node.Type != mdparser.Paragraph || node.FirstChild == nil || node.FirstChild != node.LastChild {
+		return nil, false
+	}
+	span, ok := r.math.Lookup(string(node.FirstChild.Literal))
+	if !ok || !span.Block {
+		return nil, false
+	}
+	return NewMathBlockNode(span.Math), true
+}
+
+// extractInline extracts the inline content of a node, keeping its formatting
+func (r *JSONRenderer) extractInline(node *mdparser.Node) []Node {
+	children := []Node{}
+	for n := node.FirstChild; n != nil; n = n.Next {
+		switch n.Type {
+		case mdparser.Text:
+			children = append(children, r.newTextNodes(string(n.Literal))...)
+		case mdparser.Emph:
+			children = append(children, NewEmphasisNode(NodeTypeEmphasis, r.extractInline(n)))
+		case mdparser.Strong:
+			children = append(children, NewEmphasisNode(NodeTypeStrong, r.extractInline(n)))
+		case mdparser.Del:
+			children = append(children, NewEmphasisNode(NodeTypeStrikethrough, r.extractInline(n)))
+		case mdparser.Code:
+			children = append(children, NewCodeNode(r.restoreCode(string(n.Literal))))
+		case mdparser.Link:
+			children = append(children, r.newLinkNode(n))
+		case mdparser.Image:
+			children = append(children, r.newImageNode(n))
+		case mdparser.Hardbreak:
+			children = append(children, &BaseNode{Type: NodeTypeLineBreak})
+		case mdparser.Softbreak:
+			children = append(children, &BaseNode{Type: NodeTypeSoftBreak})
+		}
+	}
+	return children
+}
+
+// newLinkNode creates a link node, telling apart inline, reference and autolinks
+// The footnote references are links of the syntax tree, they become footnote-ref nodes
+func (r *JSONRenderer) newLinkNode(node *mdparser.Node) Node {
+	if node.NoteID != 0 {
+		return r.newFootnoteRefNode(string(node.LinkData.Destination))
+	}
+
+	destination := string(node.LinkData.Destination)
+	label, title := node.LinkData.Reference, string(node.LinkData.Title)
+	isReference := label != ""
+
+	link := NewLinkNode(destination, r.extractText(node)).(*LinkNode)
+	link.Title = title
+	link.SetChildren(r.extractInline(node))
+
+	// Autolinks have a single text child matching their destination
+	isAutolink := !isReference && title == "" &&
+		node.FirstChild != nil && node.FirstChild == node.LastChild &&
+		node.FirstChild.Type == mdparser.Text
+	switch {
+	case isReference:
+		link.Kind = LinkKindReference
+		link.Label = label
+	case isAutolink && link.Text == destination:
+		link.Kind = LinkKindAutolink
+	case isAutolink && strings.HasPrefix(destination, "mailto:") && link.Text == strings.TrimPrefix(destination, "mailto:"):
+		link.Kind = LinkKindEmail
+	}
+
+	if strings.HasPrefix(destination, "#") {
+		r.anchorLinks = append(r.anchorLinks, link)
+	}
+	return link
+}
+
+// resolveAnchors resolves the in-document #anchor links to their target heading
+func (r *JSONRenderer) resolveAnchors() {
+	for _, link := range r.anchorLinks {
+		anchor := strings.TrimPrefix(link.URL, "#")
+		if decoded, err := url.PathUnescape(anchor); err == nil {
+			anchor = decoded
+		}
+		heading, ok := r.headingIDs[anchor]
+		if !ok {
+			r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningAnchor, "link %q: no heading with anchor %q", link.Text, anchor))
+			continue
+		}
+		link.Anchor = heading.ID
+		link.Target = heading
+	}
+}
+
+// newImageNode creates an image node and registers its reference
+func (r *JSONRenderer) newImageNode(node *mdparser.Node) Node {
+	image := NewImageNode(string(node.LinkData.Destination), r.extractText(node)).(*ImageNode)
+	image.Title = string(node.LinkData.Title)
+	r.limitDataURI(image)
+	if r.dataURIExtraction != nil {
+		r.extractDataURI(image)
+	}
+	if r.imageResolution != nil {
+		r.resolveImage(image)
+	}
+	// Update the image reference
+	image.Reference = r.addImage(image)
+	return image
+}
+
 // handleParagraph processes paragraph nodes and extracts text content
-func (r *JSONRenderer) handleParagraph(node *blackfriday.Node) Node {
+func (r *JSONRenderer) handleParagraph(node *mdparser.Node) Node {
 	children := r.extractContent(node)
 
 	return NewParagraphNode(children)
 }
 
+// handleBlockQuote processes blockquotes, keeping the structure of their content.
+// Blockquotes opened by a GitHub alert marker such as [!NOTE] become callouts.
+func (r *JSONRenderer) handleBlockQuote(node *mdparser.Node) Node {
+	kind := alertKind(node)
+
+	children := []Node{}
+	for n := node.FirstChild; n != nil; n = n.Next {
+		if child := r.handleBlock(n); child != nil {
+			children = append(children, child)
+		}
+	}
+
+	if kind != "" {
+		return NewCalloutNode(kind, children)
+	}
+	return &BaseNode{
+		Type:     NodeTypeBlockquote,
+		Children: children,
+	}
+}
+
+// handleBlock processes a block nested in a container such as a blockquote.
+// Nested headings do not open a section.
+func (r *JSONRenderer) handleBlock(node *mdparser.Node) Node {
+	r.checkContext()
+	switch node.Type {
+	case mdparser.Heading:
+		return r.newHeadingNode(node)
+	case mdparser.Table:
+		return r.handleTable(node)
+	case mdparser.List:
+		return r.handleList(node)
+	case mdparser.Paragraph:
+		if block, ok := r.handlePlaceholder(node); ok {
+			return block
+		}
+		return r.handleParagraph(node)
+	case mdparser.HorizontalRule:
+		return &BaseNode{
+			Type: NodeTypeLineSeparator,
+		}
+	case mdparser.BlockQuote:
+		return r.handleBlockQuote(node)
+	case mdparser.CodeBlock:
+		return r.newCodeBlockNode(node)
+	}
+	return nil
+}
+
+// alertKind returns the kind of the GitHub alert opening the blockquote,
+// removing the marker from its first paragraph
+func alertKind(node *mdparser.Node) string {
+	paragraph := node.FirstChild
+	if paragraph == nil || paragraph.Type != mdparser.Paragraph ||
+		paragraph.FirstChild == nil || paragraph.FirstChild.Type != mdparser.Text {
+		return ""
+	}
+
+	text := paragraph.FirstChild
+	match := alertRe.FindSubmatchIndex(text.Literal)
+	if match == nil {
+		return ""
+	}
+	kind := strings.ToLower(string(text.Literal[match[2]:match[3]]))
+
+	// Drop the marker, and the paragraph when it only holds the marker
+	text.Literal = text.Literal[match[1]:]
+	if len(text.Literal) == 0 {
+		text.Unlink()
+		if paragraph.FirstChild == nil {
+			paragraph.Unlink()
+		}
+	}
+	return kind
+}
+
 // handleList processes list nodes and extracts list items
-func (r *JSONRenderer) handleList(node *blackfriday.Node) Node {
+func (r *JSONRenderer) handleList(node *mdparser.Node) Node {
+	if node.ListFlags&mdparser.ListTypeDefinition != 0 {
+		return r.handleDefinitionList(node)
+	}
+
 	var listItems []Node
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.Item {
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.Item {
+			r.checkContext()
 			listItem := r.extractListItems(n)
 			listItems = append(listItems, listItem)
-			return blackfriday.SkipChildren
+			return mdparser.SkipChildren
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 	return &BaseNode{
 		Type:     NodeTypeList,
@@ -267,23 +617,57 @@ func (r *JSONRenderer) handleList(node *blackfriday.Node) Node {
 	}
 }
 
+// handleDefinitionList processes definition lists into terms and definitions
+func (r *JSONRenderer) handleDefinitionList(node *mdparser.Node) Node {
+	children := []Node{}
+	for item := node.FirstChild; item != nil; item = item.Next {
+		if item.Type != mdparser.Item {
+			continue
+		}
+
+		if item.ListFlags&mdparser.ListTypeTerm != 0 {
+			// The term is a single paragraph
+			term := []Node{}
+			for n := item.FirstChild; n != nil; n = n.Next {
+				term = append(term, r.extractInline(n)...)
+			}
+			children = append(children, NewTermNode(term))
+			continue
+		}
+
+		definition := []Node{}
+		for n := item.FirstChild; n != nil; n = n.Next {
+			switch n.Type {
+			case mdparser.Paragraph:
+				definition = append(definition, r.handleParagraph(n))
+			case mdparser.List:
+				definition = append(definition, r.handleList(n))
+			case mdparser.CodeBlock:
+				definition = append(definition, r.newCodeBlockNode(n))
+			}
+		}
+		children = append(children, NewDefinitionNode(definition))
+	}
+	return NewDefinitionListNode(children)
+}
+
 // extractListItems extracts list items from a list node
-func (r *JSONRenderer) extractListItems(node *blackfriday.Node) Node {
+func (r *JSONRenderer) extractListItems(node *mdparser.Node) Node {
 	children := []Node{}
 
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
 		if entering {
 			switch n.Type {
-			case blackfriday.List:
+			case mdparser.List:
 				list := r.handleList(n)
 				children = append(children, list)
-				return blackfriday.SkipChildren
-			case blackfriday.Item:
+				return mdparser.SkipChildren
+			case mdparser.Item:
 				listItem := r.handleParagraph(n)
 				children = append(children, listItem)
 			}
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 
 	return &BaseNode{
@@ -292,52 +676,170 @@ func (r *JSONRenderer) extractListItems(node *blackfriday.Node) Node {
 	}
 }
 
+// newFootnoteRefNode creates a footnote reference, numbering footnotes by label
+func (r *JSONRenderer) newFootnoteRefNode(label string) Node {
+	index, ok := r.footnotes[label]
+	if !ok {
+		index = len(r.footnotes) + 1
+		r.footnotes[label] = index
+	}
+	return NewFootnoteRefNode(label, index)
+}
+
+// handleFootnotes processes the footnotes list appended to the document
+func (r *JSONRenderer) handleFootnotes(node *mdparser.Node) {
+	// Footnote definitions belong to the document, not to the last heading
+	r.finalizeHeaders(0)
+	r.currentHeader = nil
+
+	footnotes := []*FootnoteDefNode{}
+	for item := node.FirstChild; item != nil; item = item.Next {
+		if item.Type != mdparser.Item {
+			continue
+		}
+		label := string(item.ListData.RefLink)
+
+		index, ok := r.footnotes[label]
+		if !ok {
+			index = len(r.footnotes) + 1
+			r.footnotes[label] = index
+		}
+		content := r.extractListItems(item).GetChildren()
+		footnotes = append(footnotes, NewFootnoteDefNode(label, index, content).(*FootnoteDefNode))
+	}
+
+	// Repeated references move the footnote to the end of the list
+	sort.SliceStable(footnotes, func(i, j int) bool {
+		return footnotes[i].Index < footnotes[j].Index
+	})
+	for _, footnote := range footnotes {
+		r.nodes = append(r.nodes, footnote)
+	}
+}
+
 // handleTable processes table nodes and extracts rows and cells
-func (r *JSONRenderer) handleTable(node *blackfriday.Node) Node {
+func (r *JSONRenderer) handleTable(node *mdparser.Node) Node {
 	var tableData interface{}
 	var headers []string
+	var dropped tableDrops
 
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if !entering {
+			return mdparser.GoToNext
+		}
 		switch n.Type {
-		case blackfriday.TableHead:
+		case mdparser.TableHead:
 			headers = r.collectTableHeaders(n)
-		case blackfriday.TableBody:
-			if headers[0] == "" {
-				tableData = r.collectTableRowsWithKeys(headers, n)
+		case mdparser.TableBody:
+			// A table without header row or with an empty first header is keyed by its first column
+			if len(headers) > 0 && headers[0] == "" {
+				tableData = r.collectTableRowsWithKeys(headers, n, &dropped)
 			} else {
-				tableData = r.collectTableRowsRegular(headers, n)
+				tableData = r.collectTableRowsRegular(headers, n, &dropped)
 			}
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
+	r.warnTable(dropped.rows, dropped.columns)
 	return NewTableNode(tableData)
 }
 
+// tableDrops counts the rows and the columns of a table dropped over the limits of the configuration
+type tableDrops struct {
+	rows    int // Body rows dropped
+	columns int // Columns dropped from the widest row
+}
+
+// limitTable drops the rows and the columns of a JSON table over the limits of the configuration,
+// the markdown tables are limited while their rows are collected
+func (r *JSONRenderer) limitTable(table *TableNode) {
+	limits := r.config.Limits
+	rows, columns := 0, 0 // Numbers of rows and columns dropped
+	switch data := table.Data.(type) {
+	case []*ordered.OrderedMap:
+		if limits.MaxTableRows > 0 && len(data) > limits.MaxTableRows {
+			rows = len(data) - limits.MaxTableRows
+			data = data[:limits.MaxTableRows]
+			table.Data = data
+		}
+		if limits.MaxTableColumns > 0 {
+			for _, row := range data {
+				columns = max(columns, truncateMap(row, limits.MaxTableColumns))
+			}
+		}
+	case *ordered.OrderedMap:
+		if limits.MaxTableRows > 0 {
+			rows = truncateMap(data, limits.MaxTableRows)
+		}
+		if limits.MaxTableColumns > 0 {
+			for _, value := range data.All() {
+				if row, ok := value.(*ordered.OrderedMap); ok {
+					// The key of the row is the first column
+					columns = max(columns, truncateMap(row, limits.MaxTableColumns-1))
+				}
+			}
+		}
+	}
+
+	r.warnTable(rows, columns)
+}
+
+// warnTable records the rows and the columns of a table dropped over the limits
+func (r *JSONRenderer) warnTable(rows, columns int) {
+	limits := r.config.Limits
+	if rows > 0 {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningLimit, "table: rows over the limit of %d dropped: %d", limits.MaxTableRows, rows))
+	}
+	if columns > 0 {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningLimit, "table: columns over the limit of %d dropped: %d", limits.MaxTableColumns, columns))
+	}
+}
+
+// truncateMap deletes the entries of an ordered map after the first ones, returning the number of entries deleted
+func truncateMap[K comparable, V any](m *orderedmap.OrderedMap[K, V], size int) int {
+	removed := max(m.Len()-size, 0)
+	i := 0
+	for key := range m.Keys() {
+		if i >= size {
+			m.Delete(key)
+		}
+		i++
+	}
+	return removed
+}
+
 // collectTableHeaders collects the headers from the table's TableHead node
-func (r *JSONRenderer) collectTableHeaders(node *blackfriday.Node) []string {
+func (r *JSONRenderer) collectTableHeaders(node *mdparser.Node) []string {
 	var headers []string
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.TableCell {
-			headers = append(headers, extractText(n))
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.TableCell {
+			headers = append(headers, r.extractText(n))
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 	return headers
 }
 
-// collectTableRowsRegular collects the rows from a table's TableBody node
-func (r *JSONRenderer) collectTableRowsRegular(headers []string, node *blackfriday.Node) []*ordered.OrderedMap {
+// collectTableRowsRegular collects the rows from a table's TableBody node,
+// counting the rows over the limit as dropped without collecting their cells
+func (r *JSONRenderer) collectTableRowsRegular(headers []string, node *mdparser.Node, dropped *tableDrops) []*ordered.OrderedMap {
+	maxRows := r.config.Limits.MaxTableRows
 	var tableData []*ordered.OrderedMap
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.TableRow {
-			currentRow := r.collectRowCells(headers, n)
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.TableRow {
+			r.checkContext()
+			if maxRows > 0 && len(tableData) >= maxRows {
+				dropped.rows++
+				return mdparser.SkipChildren
+			}
+			currentRow := r.collectRowCells(headers, n, dropped)
 			tableData = append(tableData, currentRow)
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 
 	for i := range tableData {
-		for k, v := range tableData[i].KVIter() {
+		for k, v := range tableData[i].All() {
 			if k == "" && v == "" {
 				tableData[i].Delete(k)
 			}
@@ -347,73 +849,116 @@ func (r *JSONRenderer) collectTableRowsRegular(headers []string, node *blackfrid
 	return tableData
 }
 
-// collectRowCells collects the cells from a table row node
-func (r *JSONRenderer) collectRowCells(headers []string, node *blackfriday.Node) *ordered.OrderedMap {
+// collectRowCells collects the cells from a table row node,
+// counting the cells over the column limit as dropped
+func (r *JSONRenderer) collectRowCells(headers []string, node *mdparser.Node, dropped *tableDrops) *ordered.OrderedMap {
+	columns := len(headers)
+	if maxColumns := r.config.Limits.MaxTableColumns; maxColumns > 0 {
+		columns = min(columns, maxColumns)
+	}
 	rowData := ordered.NewOrderedMap()
 	headerIndex := 0
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.TableCell {
-			if headerIndex < len(headers) {
-				rowData.Set(headers[headerIndex], extractText(n))
-				headerIndex++
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.TableCell {
+			if headerIndex < columns {
+				rowData.Set(headers[headerIndex], r.extractText(n))
 			}
+			headerIndex++
+			return mdparser.SkipChildren
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
+	dropped.columns = max(dropped.columns, min(headerIndex, len(headers))-columns)
 	return rowData
 }
 
-// collectTableRowsWithKeys collects the rows from a table's TableBody node
-func (r *JSONRenderer) collectTableRowsWithKeys(headers []string, node *blackfriday.Node) *ordered.OrderedMap {
+// collectTableRowsWithKeys collects the rows from a table's TableBody node,
+// counting the rows over the limit as dropped without collecting their cells
+func (r *JSONRenderer) collectTableRowsWithKeys(headers []string, node *mdparser.Node, dropped *tableDrops) *ordered.OrderedMap {
+	maxRows := r.config.Limits.MaxTableRows
 	tableData := ordered.NewOrderedMap()
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.TableRow {
-			key, currentRow := r.collectRowCellsWithKeys(headers, n)
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.TableRow {
+			r.checkContext()
+			if maxRows > 0 && tableData.Len() >= maxRows {
+				dropped.rows++
+				return mdparser.SkipChildren
+			}
+			key, currentRow := r.collectRowCellsWithKeys(headers, n, dropped)
 			tableData.Set(key, currentRow)
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 	return tableData
 }
 
 // collectRowCellsWithKeys collects the cells from a table row node
-func (r *JSONRenderer) collectRowCellsWithKeys(headers []string, node *blackfriday.Node) (key string, rowData *ordered.OrderedMap) {
+func (r *JSONRenderer) collectRowCellsWithKeys(headers []string, node *mdparser.Node, dropped *tableDrops) (key string, rowData *ordered.OrderedMap) {
 	firstCell := false
-	rowData = r.collectRowCells(headers, node)
-	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
-		if entering && n.Type == blackfriday.TableCell {
+	rowData = r.collectRowCells(headers, node, dropped)
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		if entering && n.Type == mdparser.TableCell {
 			if !firstCell {
-				key = extractText(n)
+				key = r.extractText(n)
 				firstCell = true
 				rowData.Delete(headers[0])
-				return blackfriday.Terminate
+				return mdparser.Terminate
 			}
 		}
-		return blackfriday.GoToNext
+		return mdparser.GoToNext
 	})
 	return key, rowData
 }
 
-// addImage adds an image reference to the imageRefs map
+// AddImage registers an image parsed by another renderer, such as the image of a
+// transcluded page, and updates its reference
+func (r *JSONRenderer) AddImage(image *ImageNode) {
+	image.Reference = r.addImage(image)
+}
+
+// addImage adds an image reference to the imageRefs list.
+// The dropped images are not registered, their reference is 0.
 func (r *JSONRenderer) addImage(image Node) int {
+	img := image.(*ImageNode)
+	if img.Dropped {
+		return 0
+	}
+
 	// Check if the image reference already exists
-	for i, ref := range r.imageRefs {
-		if ref.(*ImageNode).URL == image.(*ImageNode).URL {
-			return i + 1
-		}
+	if i, ok := r.imageIndex[img.URL]; ok {
+		ref := r.imageRefs[i]
+		ref.Count++
+		return ref.Reference
 	}
 
 	// Add new image reference
-	r.imageRefs = append(r.imageRefs, image)
-	return len(r.imageRefs)
+	ref := NewImageRef(len(r.imageRefs)+1, img)
+	r.imageIndex[img.URL] = len(r.imageRefs)
+	r.imageRefs = append(r.imageRefs, ref)
+	return ref.Reference
+}
+
+// GetImageRefs returns the image references ordered by their reference number
+func (r *JSONRenderer) GetImageRefs() []ImageRef {
+	images := make([]ImageRef, len(r.imageRefs))
+	for i, ref := range r.imageRefs {
+		images[i] = *ref
+	}
+	return images
+}
+
+// GetWarnings returns the non-fatal problems found during the conversion
+func (r *JSONRenderer) GetWarnings() []mdparser.Warning {
+	return slices.Clone(r.warnings)
 }
 
-// GetImageURLs returns the image references
+// GetImageURLs returns the image URLs keyed by their {IMG:n} placeholder
+//
+// Deprecated: the map has no stable order, use GetImageRefs instead.
 func (r *JSONRenderer) GetImageURLs() map[string]string {
 	images := make(map[string]string, len(r.imageRefs))
-	for _, image := range r.imageRefs {
-		img := image.(*ImageNode)
-		images[img.ToReference()] = img.URL
+	for _, ref := range r.imageRefs {
+		images[ref.ToReference()] = ref.URL
 	}
 	return images
 }
@@ -1,10 +1,21 @@
 package mdtojson
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
-	"github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	ordered "github.com/stencilframe/mdtools/libs/ordered_map"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,6 +24,7 @@ func TestJSONRenderer(t *testing.T) {
 		name             string
 		inputFileName    string
 		expectedFileName string
+		options          []Option
 	}{
 		{
 			name:             "Headers",
@@ -34,11 +46,77 @@ func TestJSONRenderer(t *testing.T) {
 			inputFileName:    "testdata/links.md",
 			expectedFileName: "testdata/links.json",
 		},
+		{
+			name:             "LinkStyles",
+			inputFileName:    "testdata/link_styles.md",
+			expectedFileName: "testdata/link_styles.json",
+		},
+		{
+			name:             "Footnotes",
+			inputFileName:    "testdata/footnotes.md",
+			expectedFileName: "testdata/footnotes.json",
+		},
+		{
+			name:             "Definitions",
+			inputFileName:    "testdata/definitions.md",
+			expectedFileName: "testdata/definitions.json",
+		},
 		{
 			name:             "Images",
 			inputFileName:    "testdata/images.md",
 			expectedFileName: "testdata/images.json",
 		},
+		{
+			name:             "HeadingMarkup",
+			inputFileName:    "testdata/heading_markup.md",
+			expectedFileName: "testdata/heading_markup.json",
+		},
+		{
+			name:             "Blockquotes",
+			inputFileName:    "testdata/blockquotes.md",
+			expectedFileName: "testdata/blockquotes.json",
+		},
+		{
+			name:             "Containers",
+			inputFileName:    "testdata/containers.md",
+			expectedFileName: "testdata/containers.json",
+		},
+		{
+			name:             "Math",
+			inputFileName:    "testdata/math.md",
+			expectedFileName: "testdata/math.json",
+			options:          []Option{WithParserConfig(mdparser.NewConfig(mdparser.WithMath()))},
+		},
+		{
+			name:             "Anchors",
+			inputFileName:    "testdata/anchors.md",
+			expectedFileName: "testdata/anchors.json",
+		},
+		{
+			name:             "Diagrams",
+			inputFileName:    "testdata/diagrams.md",
+			expectedFileName: "testdata/diagrams.json",
+		},
+		{
+			name:             "WikiLinks",
+			inputFileName:    "testdata/wikilinks.md",
+			expectedFileName: "testdata/wikilinks.json",
+			options:          []Option{WithWikiLinks(WikiLinks{Extension: ".md"})},
+		},
+		{
+			name:             "Typography",
+			inputFileName:    "testdata/typography.md",
+			expectedFileName: "testdata/typography.json",
+			options: []Option{WithParserConfig(mdparser.NewConfig(
+				mdparser.WithEmoji(), mdparser.WithAbbreviations(), mdparser.WithSmartTypography(),
+			))},
+		},
+		{
+			name:             "ListsGoldmark",
+			inputFileName:    "testdata/lists.md",
+			expectedFileName: "testdata/lists.goldmark.json",
+			options:          []Option{WithParserConfig(mdparser.NewConfig(mdparser.WithBackend(mdparser.BackendGoldmark)))},
+		},
 	}
 
 	for _, tt := range tests {
@@ -48,13 +126,13 @@ func TestJSONRenderer(t *testing.T) {
 			assert.NoError(t, err)
 
 			// Initialize a new JSONRenderer
-			renderer := NewJSONRenderer()
+			renderer := NewJSONRenderer(tt.options...)
 
 			// Convert the markdown to JSON
-			out := blackfriday.Run(markdownData,
-				blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.AutoHeadingIDs|blackfriday.Tables),
-				blackfriday.WithRenderer(renderer),
-			)
+			nodes, err := renderer.Parse(markdownData)
+			assert.NoError(t, err)
+			out, err := json.Marshal(nodes)
+			assert.NoError(t, err)
 
 			// Assert the resulting JSON
 			expectedData, err := os.ReadFile(tt.expectedFileName)
@@ -63,3 +141,716 @@ func TestJSONRenderer(t *testing.T) {
 		})
 	}
 }
+
+func TestDataURIExtraction(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxBytes      int64
+		expectedFiles int
+		expectedURL   string
+		warnings      int
+	}{
+		{
+			name:          "Extracted",
+			expectedFiles: 1,
+			expectedURL:   "https://cdn.example.com/img/a8f2dc330fd651392d85409dd3acdbc8dead1624701145e0b511b3cc77782fcc.png",
+		},
+		{
+			name:     "OverLimit",
+			maxBytes: 10,
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markdownData, err := os.ReadFile("testdata/images.md")
+			assert.NoError(t, err)
+
+			dir := t.TempDir()
+			renderer := NewJSONRenderer(WithDataURIExtraction(DataURIExtraction{
+				Dir:       dir,
+				URLPrefix: "https://cdn.example.com/img/",
+				MaxBytes:  tt.maxBytes,
+			}))
+			_, err = renderer.Parse(markdownData)
+			assert.NoError(t, err)
+
+			files, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, files, tt.expectedFiles)
+			assert.Len(t, renderer.GetWarnings(), tt.warnings)
+
+			// The data URI image is the last one in the document, the dropped image is not registered
+			refs := renderer.GetImageRefs()
+			image := refs[len(refs)-1]
+			if tt.expectedURL == "" {
+				assert.False(t, isDataURI(image.URL))
+				assert.NotEmpty(t, image.URL)
+				return
+			}
+			assert.Equal(t, tt.expectedURL, image.URL)
+			assert.Equal(t, "image/png", image.MIMEType)
+		})
+	}
+}
+
+func TestDataURIExtractionConcurrent(t *testing.T) {
+	markdownData := []byte("![pixel](data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==)\n")
+	dir := t.TempDir()
+	converter := NewConverter(WithDataURIExtraction(DataURIExtraction{Dir: dir}))
+
+	// The conversions write the same image at the same time, each one renaming its own file into place
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := converter.Convert(context.Background(), markdownData)
+			assert.NoError(t, err)
+			assert.Empty(t, result.Warnings)
+		}()
+	}
+	wg.Wait()
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1, "no temporary file is left") {
+		data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), data)
+	}
+}
+
+func TestDroppedImages(t *testing.T) {
+	markdownData := []byte("![first](data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==) and " +
+		"![second](data:image/gif;base64,R0lGODlhAQABAIAAAP==)\n\n![logo](https://example.com/logo.png)\n")
+	renderer := NewJSONRenderer(WithParserConfig(mdparser.NewConfig(mdparser.WithLimits(mdparser.Limits{MaxDataURIBytes: 16}))))
+	result, err := renderer.Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+
+	// The dropped images keep their own alt text and are not merged into one reference
+	paragraph := result.Nodes[0].GetChildren()
+	first, second := paragraph[0].(*ImageNode), paragraph[2].(*ImageNode)
+	assert.True(t, first.Dropped)
+	assert.True(t, second.Dropped)
+	assert.Equal(t, "[Image: first]", first.ToInline())
+	assert.Equal(t, "[Image: second]", second.ToReference())
+	assert.Equal(t, "image/gif", second.MIMEType)
+	assert.Zero(t, second.Reference)
+
+	assert.Equal(t, []ImageRef{
+		{Reference: 1, URL: "https://example.com/logo.png", Alt: "logo", Count: 1},
+	}, result.Images)
+	assert.Len(t, result.Warnings, 2)
+}
+
+func TestImageResolution(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       ImageResolution
+		expectedURLs []string
+	}{
+		{
+			name:   "BaseDir",
+			config: ImageResolution{BaseDir: "testdata"},
+			expectedURLs: []string{
+				"testdata/assets/icon.png",
+				"testdata/assets/missing.png",
+				"https://example.com/image.png",
+			},
+		},
+		{
+			name:   "BaseURL",
+			config: ImageResolution{BaseDir: "testdata", BaseURL: "https://docs.example.com/guide/"},
+			expectedURLs: []string{
+				"https://docs.example.com/guide/assets/icon.png",
+				"https://docs.example.com/guide/assets/missing.png",
+				"https://example.com/image.png",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markdownData, err := os.ReadFile("testdata/local_images.md")
+			assert.NoError(t, err)
+
+			renderer := NewJSONRenderer(WithImageResolution(tt.config))
+			_, err = renderer.Parse(markdownData)
+			assert.NoError(t, err)
+
+			refs := renderer.GetImageRefs()
+			urls := []string{}
+			for _, ref := range refs {
+				urls = append(urls, ref.URL)
+			}
+			assert.Equal(t, tt.expectedURLs, urls)
+
+			// The local image is sniffed, the missing one is reported
+			assert.Equal(t, "image/png", refs[0].MIMEType)
+			assert.Equal(t, 21, refs[0].Width)
+			assert.Equal(t, 21, refs[0].Height)
+			assert.Len(t, renderer.GetWarnings(), 1)
+			assert.Contains(t, renderer.GetWarnings()[0].Message, "assets/missing.png")
+		})
+	}
+}
+
+func TestImageResolutionContainment(t *testing.T) {
+	markdownData := []byte("![a](../../x.png) ![b](/etc/passwd) ![c](assets) ![d](assets/icon.png?v=2#dark)\n")
+	renderer := NewJSONRenderer(WithImageResolution(ImageResolution{BaseDir: "testdata"}))
+	_, err := renderer.Parse(markdownData)
+	assert.NoError(t, err)
+
+	// The files are looked up inside the base directory, the query and the fragment are kept
+	urls := []string{}
+	for _, ref := range renderer.GetImageRefs() {
+		urls = append(urls, ref.URL)
+	}
+	assert.Equal(t, []string{"../../x.png", "testdata/etc/passwd", "testdata/assets", "testdata/assets/icon.png?v=2#dark"}, urls)
+	assert.Equal(t, "image/png", renderer.GetImageRefs()[3].MIMEType)
+
+	warnings := renderer.GetWarnings()
+	if assert.Len(t, warnings, 3) {
+		assert.Equal(t, mdparser.Warning{Kind: mdparser.WarningImage, Message: `image "a": "../../x.png" is outside of the base directory`}, warnings[0])
+		assert.Contains(t, warnings[1].Message, `broken reference "/etc/passwd"`)
+		assert.Contains(t, warnings[2].Message, "not a regular file")
+	}
+}
+
+func TestImageResolutionSymlinks(t *testing.T) {
+	icon, err := filepath.Abs("testdata/assets/icon.png")
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "assets"), 0o755))
+	assert.NoError(t, os.Symlink(icon, filepath.Join(dir, "outside.png")))
+	assert.NoError(t, os.Symlink("../assets", filepath.Join(dir, "assets", "parent")))
+	data, err := os.ReadFile(icon)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "icon.png"), data, 0o644))
+
+	markdownData := []byte("![a](outside.png) ![b](assets/parent/icon.png)\n")
+	renderer := NewJSONRenderer(WithImageResolution(ImageResolution{BaseDir: dir}))
+	_, err = renderer.Parse(markdownData)
+	assert.NoError(t, err)
+
+	// The link pointing outside of the base directory is rejected, the one staying inside is resolved
+	warnings := renderer.GetWarnings()
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, mdparser.Warning{Kind: mdparser.WarningImage, Message: `image "a": "outside.png" is outside of the base directory`}, warnings[0])
+	}
+	refs := renderer.GetImageRefs()
+	assert.Equal(t, "image/png", refs[1].MIMEType)
+	assert.Equal(t, 21, refs[1].Width)
+}
+
+func TestLinkToMarkdown(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/link_styles.md")
+	assert.NoError(t, err)
+
+	links := []string{}
+	for _, paragraph := range parse(t, NewJSONRenderer(), markdownData) {
+		for _, node := range paragraph.GetChildren() {
+			if node.GetType() == NodeTypeLink {
+				links = append(links, node.ToMarkdown())
+			}
+		}
+	}
+
+	assert.Equal(t, []string{
+		`[link with **bold** text](https://example.com/inline "Inline title")`,
+		`[link][docs]`,
+		`[Docs]`,
+		`<https://example.com/auto>`,
+		`<hello@example.com>`,
+	}, links)
+}
+
+func TestChunkTable(t *testing.T) {
+	values := []any{
+		"plain", "<a href=\"x\">&amp;</a>", "\u2028\u2029", "\x00\x1f\b\f\n\r\t\\", "\xffinvalid", "\u00e9\u65e5\u00ad",
+		0.0, math.Copysign(0, -1), 1e21, 1e20, 1e-6, 1e-7, 123.456, -5e-324, math.NaN(),
+		true, false, nil, []any{}, []any(nil), []any{"a", 1.5, []any{nil}}, 42,
+	}
+	keys := []string{"key", "<key>", "k\u00e9", "k\u00ad", "k\x01", "k\xff", "k\u2028"}
+
+	// The rows are encoded as json.Marshal encodes them, the rows which fail to marshal are left out.
+	// The keys of the keyed rows do not escape the HTML characters.
+	rows := []*ordered.OrderedMap{nil, ordered.NewOrderedMap()}
+	keyed := ordered.NewOrderedMap()
+	for i, value := range values {
+		row := ordered.NewOrderedMap()
+		row.Set(keys[i%len(keys)], value)
+		nested := ordered.NewOrderedMap()
+		nested.Set(keys[(i+1)%len(keys)], value)
+		row.Set("nested", nested)
+		rows = append(rows, row)
+		keyed.Set(keys[i%len(keys)]+fmt.Sprint(i), row)
+	}
+	var array, object bytes.Buffer
+	for _, row := range rows {
+		if j, err := json.Marshal(row); err == nil {
+			array.WriteString(string(j) + ",\n")
+		}
+	}
+	enc := json.NewEncoder(&object)
+	enc.SetEscapeHTML(false)
+	for key, row := range keyed.All() {
+		if j, err := json.Marshal(row); err == nil {
+			assert.NoError(t, enc.Encode(key))
+			object.Truncate(object.Len() - 1)
+			fmt.Fprintf(&object, ": %s,\n", j)
+		}
+	}
+	chunks, err := NewTableNode(rows).(*TableNode).ChunkTable(math.MaxInt, math.MaxInt)
+	assert.Equal(t, []string{jsonTableChunk("[\n", array.Bytes(), "]")}, chunks)
+	assert.ErrorContains(t, err, "table row 17: ")
+	assert.ErrorContains(t, err, "unsupported value: NaN")
+	chunks, err = NewTableNode(keyed).(*TableNode).ChunkTable(math.MaxInt, math.MaxInt)
+	assert.Equal(t, []string{jsonTableChunk("{\n", object.Bytes(), "}")}, chunks)
+	assert.ErrorContains(t, err, `table row "key14": `)
+	assert.Contains(t, chunks[0], "\n\"<key>1\": {\"\\u003ckey\\u003e\":")
+	assert.Contains(t, chunks[0], "\n\"k\\u00014\": ")
+
+	// The rows start a new chunk when they exceed the limit, an oversized row keeps its own chunk
+	table := NewTableNode(rows[2:5]).(*TableNode)
+	chunks, err = table.ChunkTable(0, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		":::json_table\n[\n]\n:::\n\n",
+		":::json_table\n[\n{\"key\":\"plain\",\"nested\":{\"\\u003ckey\\u003e\":\"plain\"}},\n]\n:::\n\n",
+		":::json_table\n[\n{\"\\u003ckey\\u003e\":\"\\u003ca href=\\\"x\\\"\\u003e\\u0026amp;\\u003c/a\\u003e\",\"nested\":{\"k\u00e9\":\"\\u003ca href=\\\"x\\\"\\u003e\\u0026amp;\\u003c/a\\u003e\"}},\n]\n:::\n\n",
+		":::json_table\n[\n{\"k\u00e9\":\"\\u2028\\u2029\",\"nested\":{\"k\u00ad\":\"\\u2028\\u2029\"}},\n]\n:::\n\n",
+	}, chunks)
+}
+
+func BenchmarkChunkTable(b *testing.B) {
+	// A table well over the default row limit, built without parsing
+	rows := make([]*ordered.OrderedMap, 200_000)
+	for i := range rows {
+		rows[i] = ordered.NewOrderedMap()
+		rows[i].Set("ID", strconv.Itoa(i))
+		rows[i].Set("Name", "Item "+strconv.Itoa(i))
+		rows[i].Set("Price", float64(i)/100)
+	}
+	table := NewTableNode(rows).(*TableNode)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range table.Chunks(4000, 4000) {
+		}
+	}
+}
+
+func TestHeadingToMarkdown(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/heading_markup.md")
+	assert.NoError(t, err)
+
+	document := parse(t, NewJSONRenderer(), markdownData)[0]
+	headings := []string{document.ToMarkdown()}
+	for _, node := range document.GetChildren() {
+		if node.GetType() == NodeTypeHeading {
+			headings = append(headings, node.ToMarkdown())
+		}
+	}
+
+	assert.Equal(t, []string{
+		"# The `Config` type\n\n",
+		"## Loading from [YAML](https://yaml.org) files\n\n",
+		"## **Strict** and *lenient* modes {#modes}\n\n",
+	}, headings)
+}
+
+func TestDefinitionListToMarkdown(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/definitions.md")
+	assert.NoError(t, err)
+
+	heading := parse(t, NewJSONRenderer(), markdownData)[0]
+	definitions := heading.GetChildren()[0]
+	assert.Equal(t, "API\n"+
+		": Application programming interface\n"+
+		": A contract between programs\n"+
+		"\n"+
+		"SDK\n"+
+		": Software development kit\n"+
+		"\n"+
+		"    With a second paragraph.\n"+
+		"\n", definitions.ToMarkdown())
+}
+
+func TestAnchors(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/anchors.md")
+	assert.NoError(t, err)
+
+	renderer := NewJSONRenderer()
+	document := parse(t, renderer, markdownData)[0].(*HeadingNode)
+
+	// The links resolve to their target heading
+	link := document.GetChildren()[0].GetChildren()[5].(*LinkNode)
+	assert.Equal(t, "install", link.Anchor)
+	assert.Equal(t, "Installing the tool", link.Target.Title)
+	assert.Equal(t, "## Installing the tool {#install}\n\n", link.Target.ToMarkdown())
+
+	// Links without a target are reported
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningAnchor, Message: `link "link": no heading with anchor "missing"`},
+	}, renderer.GetWarnings())
+}
+
+func TestConvert(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/anchors.md")
+	assert.NoError(t, err)
+
+	result, err := NewJSONRenderer().Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+	assert.Equal(t, parse(t, NewJSONRenderer(), markdownData), result.Nodes)
+	assert.Empty(t, result.Images)
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningAnchor, Message: `link "link": no heading with anchor "missing"`},
+	}, result.Warnings)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewJSONRenderer().Convert(ctx, markdownData)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// countdownContext is a context done after a number of checks, cancelling a conversion half way
+type countdownContext struct {
+	context.Context
+	checks int
+}
+
+func (c *countdownContext) Err() error {
+	if c.checks--; c.checks < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestConverter(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(t, err)
+	options := []Option{WithParserConfig(mdparser.NewConfig(mdparser.WithEmoji(), mdparser.WithAbbreviations()))}
+
+	expected := make([]string, len(files))
+	for i, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		nodes := parse(t, NewJSONRenderer(options...), markdownData)
+		data, err := json.Marshal(nodes)
+		assert.NoError(t, err)
+		expected[i] = string(data)
+	}
+
+	// The documents are converted concurrently by a shared converter, several times each
+	converter := NewConverter(options...)
+	actual := make([]string, 4*len(files))
+	var wg sync.WaitGroup
+	for i := range actual {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			markdownData, err := os.ReadFile(files[i%len(files)])
+			assert.NoError(t, err)
+			result, err := converter.Convert(context.Background(), markdownData)
+			assert.NoError(t, err)
+			data, err := json.Marshal(result.Nodes)
+			assert.NoError(t, err)
+			actual[i] = string(data)
+		}()
+	}
+	wg.Wait()
+	for i := range actual {
+		assert.Equal(t, expected[i%len(files)], actual[i], files[i%len(files)])
+	}
+}
+
+func TestGetNodes(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/headers.md")
+	assert.NoError(t, err)
+
+	renderer := NewJSONRenderer()
+	nodes := parse(t, renderer, markdownData)
+	assert.Equal(t, nodes, renderer.GetNodes())
+	assert.Len(t, renderer.GetNodes(), len(nodes))
+}
+
+func TestRendererReuse(t *testing.T) {
+	first, err := os.ReadFile("testdata/anchors.md")
+	assert.NoError(t, err)
+	second := []byte("# Title\n\n![image](image.png)\n")
+
+	// Each conversion starts a new document
+	renderer := NewJSONRenderer()
+	_, err = renderer.Convert(context.Background(), first)
+	assert.NoError(t, err)
+	result, err := renderer.Convert(context.Background(), second)
+	assert.NoError(t, err)
+
+	expected, err := NewJSONRenderer().Convert(context.Background(), second)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+	assert.Equal(t, result.Nodes, renderer.GetNodes())
+	assert.Empty(t, result.Warnings)
+}
+
+func TestConvertCancel(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("# Table\n\n| a | b |\n|---|---|\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, "| %d | %d |\n", i, i)
+	}
+	markdownData := []byte(sb.String())
+
+	// The context is checked between the table rows
+	ctx := &countdownContext{Context: context.Background(), checks: 100}
+	_, err := NewJSONRenderer().Convert(ctx, markdownData)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, ctx.checks, 0)
+
+	ctx = &countdownContext{Context: context.Background(), checks: 2000}
+	result, err := NewJSONRenderer().Convert(ctx, markdownData)
+	assert.NoError(t, err)
+	assert.Len(t, result.Nodes, 1)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err = NewJSONRenderer().Convert(timeout, markdownData)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLimits(t *testing.T) {
+	convert := func(limits mdparser.Limits, markdown string) (Result, error) {
+		renderer := NewJSONRenderer(WithParserConfig(mdparser.NewConfig(mdparser.WithLimits(limits))))
+		return renderer.Convert(context.Background(), []byte(markdown))
+	}
+
+	// The documents over the input size or the node count are rejected
+	_, err := convert(mdparser.Limits{MaxInputBytes: 4}, "Hello")
+	assert.EqualError(t, err, "markdown: 5 input bytes exceed the limit of 4")
+	var limitError *mdparser.LimitError
+	_, err = convert(mdparser.Limits{MaxNodes: 6}, "Text\n\n:::note\nNested *text*\n:::\n")
+	if assert.ErrorAs(t, err, &limitError) {
+		assert.Equal(t, "nodes", limitError.Limit)
+	}
+
+	// The deeper nodes are dropped, the container blocks are nested in the document
+	result, err := convert(mdparser.Limits{MaxDepth: 4}, "- a\n  - b\n\n:::note\n> > quote\n:::\n")
+	assert.NoError(t, err)
+	markdown, err := json.Marshal(result.Nodes)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type": "list", "content": [{"type": "listitem", "content": [
+			{"type": "paragraph", "content": [{"type": "text", "text": "a"}]},
+			{"type": "list", "content": [{"type": "listitem", "content": [{"type": "paragraph"}]}]}
+		]}]},
+		{"type": "container", "name": "note", "content": [
+			{"type": "blockquote", "content": [{"type": "blockquote", "content": [{"type": "paragraph"}]}]}
+		]}
+	]`, string(markdown))
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningLimit, Message: "nodes nested deeper than 4 dropped: 2"},
+		{Kind: mdparser.WarningLimit, Message: "nodes nested deeper than 4 dropped: 1"},
+	}, result.Warnings)
+
+	// The tables and the data URI images are truncated
+	result, err = convert(mdparser.Limits{MaxTableRows: 1, MaxTableColumns: 2, MaxDataURIBytes: 16},
+		"| a | b | c |\n|---|---|---|\n| 1 | 2 | 3 |\n| 4 | 5 | 6 |\n\n![dot](data:image/png;base64,iVBORw0KGgo=)\n")
+	assert.NoError(t, err)
+	markdown, err = json.Marshal(result.Nodes)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type": "table", "data": [{"a": "1", "b": "2"}]},
+		{"type": "paragraph", "content": [{"type": "image", "url": "", "alt": "dot", "mimeType": "image/png", "reference": 0, "dropped": true}]}
+	]`, string(markdown))
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningLimit, Message: "table: rows over the limit of 1 dropped: 1"},
+		{Kind: mdparser.WarningLimit, Message: "table: columns over the limit of 2 dropped: 1"},
+		{Kind: mdparser.WarningLimit, Message: `image "dot": data URI of 34 bytes exceeds the limit of 16 bytes`},
+	}, result.Warnings)
+
+	// The rows of the tables keyed by their first column are limited while they are collected,
+	// the key being one of the columns
+	result, err = convert(mdparser.Limits{MaxTableRows: 1, MaxTableColumns: 2},
+		"|   | b | c |\n|---|---|---|\n| k | 2 | 3 |\n| l | 5 | 6 |\n| m | 8 | 9 |\n")
+	assert.NoError(t, err)
+	markdown, err = json.Marshal(result.Nodes)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type": "table", "data": {"k": {"b": "2"}}}]`, string(markdown))
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningLimit, Message: "table: rows over the limit of 1 dropped: 2"},
+		{Kind: mdparser.WarningLimit, Message: "table: columns over the limit of 2 dropped: 1"},
+	}, result.Warnings)
+
+	// The nested containers share the node budget of the document, on both backends
+	for _, backend := range []string{mdparser.BackendBlackfriday, mdparser.BackendGoldmark} {
+		config := mdparser.NewConfig(mdparser.WithBackend(backend), mdparser.WithLimits(mdparser.Limits{MaxNodes: 10}))
+		_, err = NewJSONRenderer(WithParserConfig(config)).Convert(context.Background(),
+			[]byte("::::outer\n:::inner\nNested *text*\n:::\n::::\n"))
+		if assert.ErrorAs(t, err, &limitError, backend) {
+			assert.Equal(t, &mdparser.LimitError{Limit: "nodes", Value: 11, Max: 10}, limitError)
+		}
+	}
+}
+
+func TestSlugger(t *testing.T) {
+	slugger := NewSlugger()
+	slugs := []string{}
+	for _, text := range []string{"Hello World", "Hello World", "Hello World 1", "FAQ & Notes", "Übersicht (v2.0)", "snake_case"} {
+		slugs = append(slugs, slugger.Slug(text))
+	}
+	assert.Equal(t, []string{"hello-world", "hello-world-1", "hello-world-1-1", "faq--notes", "übersicht-v20", "snake_case"}, slugs)
+}
+
+func TestParseMermaid(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected *DiagramGraph
+	}{
+		{
+			name: "Chained links",
+			code: "graph TD; A[Start] --> B --> C[End]",
+			expected: &DiagramGraph{
+				Kind:  DiagramKindFlowchart,
+				Nodes: []DiagramLabel{{ID: "A", Label: "Start"}, {ID: "B", Label: "B"}, {ID: "C", Label: "End"}},
+				Edges: []DiagramEdge{{From: "A", To: "B"}, {From: "B", To: "C"}},
+			},
+		},
+		{
+			name: "Labels and subgraphs",
+			code: "flowchart LR\n  subgraph one\n    A -. \"maybe\" .-> B[\"Version 1.2\"]\n  end\n  B ==> A",
+			expected: &DiagramGraph{
+				Kind:  DiagramKindFlowchart,
+				Nodes: []DiagramLabel{{ID: "A", Label: "A"}, {ID: "B", Label: "Version 1.2"}},
+				Edges: []DiagramEdge{{From: "A", To: "B", Label: "maybe"}, {From: "B", To: "A"}},
+			},
+		},
+		{
+			name: "Sequence diagram",
+			code: "sequenceDiagram\n  actor U as User\n  U->>+API: GET /items\n  API--)U: 200 OK",
+			expected: &DiagramGraph{
+				Kind:  DiagramKindSequence,
+				Nodes: []DiagramLabel{{ID: "U", Label: "User"}, {ID: "API", Label: "API"}},
+				Edges: []DiagramEdge{{From: "U", To: "API", Label: "GET /items"}, {From: "API", To: "U", Label: "200 OK"}},
+			},
+		},
+		{
+			name: "Other diagrams",
+			code: "pie title Pets\n  \"Dogs\" : 386",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseMermaid(tt.code))
+		})
+	}
+}
+
+func TestMath(t *testing.T) {
+	markdownData := []byte("Sum $a_i$\n\n    echo $HOME/$PATH\n\n- Item\n\n  ```sh\n  echo $HOME/$PATH\n  ```\n\nA `code $x$\nspan`\n")
+	nodes := parse(t, NewJSONRenderer(WithParserConfig(mdparser.NewConfig(mdparser.WithMath()))), markdownData)
+	assert.Equal(t, NodeTypeMath, nodes[0].GetChildren()[1].GetType())
+
+	// The code blocks and spans keep their dollars
+	data, err := json.Marshal(nodes)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "\uE001")
+	assert.Equal(t, 2, strings.Count(string(data), `echo $HOME/$PATH\n"`))
+	assert.Contains(t, string(data), `"code":"code $x$\nspan"`)
+
+	// Without the option the math is literal text
+	nodes = parse(t, NewJSONRenderer(), markdownData)
+	assert.Equal(t, "Sum $a_i$", nodes[0].GetChildren()[0].(*TextNode).Text)
+}
+
+func TestWikiLinks(t *testing.T) {
+	markdownData, err := os.ReadFile("testdata/wikilinks.md")
+	assert.NoError(t, err)
+
+	renderer := NewJSONRenderer(WithWikiLinks(WikiLinks{BaseURL: "https://kb.example.com/", Extension: ".html"}))
+	document := parse(t, renderer, markdownData)[0].(*HeadingNode)
+
+	// The links keep their wiki syntax and point to the pages
+	paragraph := document.GetChildren()[0].GetChildren()
+	assert.Equal(t, "[[Getting Started]]", paragraph[1].ToMarkdown())
+	assert.Equal(t, "[[Getting Started#Install steps|install guide]]", paragraph[3].ToMarkdown())
+	assert.Equal(t, "https://kb.example.com/Getting%20Started.html#install-steps", paragraph[3].(*LinkNode).URL)
+	assert.Equal(t, "Related notes", paragraph[5].(*LinkNode).Target.Title)
+	assert.Equal(t, "![[Architecture#Storage layer]]", document.GetChildren()[2].ToMarkdown())
+
+	// Links to missing sections of the document are reported
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningAnchor, Message: `link "Missing section": no heading with anchor "missing-section"`},
+	}, renderer.GetWarnings())
+
+	// Without the extension the wiki links are literal text
+	document = parse(t, NewJSONRenderer(), markdownData)[0].(*HeadingNode)
+	assert.Equal(t, NodeTypeParagraph, document.GetChildren()[2].GetType())
+
+	// The wiki links of the code blocks are literal
+	nodes := parse(t, NewJSONRenderer(WithWikiLinks(WikiLinks{})), []byte("Text\n\n    [[Page]]\n\n- Item\n\n  ```\n  ![[Page]]\n  ```\n"))
+	data, err := json.Marshal(nodes)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"code":"[[Page]]\n"`)
+	assert.Contains(t, string(data), `![[Page]]\n"`)
+	assert.NotContains(t, string(data), "\uE002")
+}
+
+func TestReservedCharacters(t *testing.T) {
+	markdownData := []byte("A \uE0020\uE002 link [[Page]]\n\n\uE000container:0\uE000\n")
+	result, err := NewJSONRenderer(WithWikiLinks(WikiLinks{})).Convert(context.Background(), markdownData)
+	assert.NoError(t, err)
+
+	// The reserved characters of the document are not mistaken for placeholders
+	paragraph := result.Nodes[0].GetChildren()
+	assert.Equal(t, "A \uFFFD0\uFFFD link ", paragraph[0].(*TextNode).Text)
+	assert.Equal(t, "Page", paragraph[1].(*LinkNode).Page)
+	assert.Equal(t, "\uFFFDcontainer:0\uFFFD", result.Nodes[1].GetChildren()[0].(*TextNode).Text)
+	assert.Equal(t, []mdparser.Warning{
+		{Kind: mdparser.WarningInput, Message: "reserved private use characters U+E000 to U+E002 replaced: 4"},
+	}, result.Warnings)
+}
+
+// parse parses the markdown data with the renderer, failing the test on error
+func parse(t *testing.T, renderer *JSONRenderer, markdownData []byte) []Node {
+	t.Helper()
+	nodes, err := renderer.Parse(markdownData)
+	assert.NoError(t, err)
+	return nodes
+}
+
+func FuzzJSONRenderer(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.md")
+	assert.NoError(f, err)
+	for _, file := range files {
+		markdownData, err := os.ReadFile(file)
+		assert.NoError(f, err)
+		f.Add(markdownData, false)
+	}
+	f.Add([]byte("| |\n|-|\n| a |\n"), false)
+	f.Add([]byte("> quote\n>\n> - item\n"), true)
+
+	f.Fuzz(func(t *testing.T, markdownData []byte, goldmark bool) {
+		backend := mdparser.BackendBlackfriday
+		if goldmark {
+			backend = mdparser.BackendGoldmark
+		}
+		renderer := NewJSONRenderer(
+			WithParserConfig(mdparser.NewConfig(mdparser.WithBackend(backend),
+				mdparser.WithEmoji(), mdparser.WithAbbreviations(), mdparser.WithSmartTypography(), mdparser.WithMath())),
+			WithWikiLinks(WikiLinks{Extension: ".md"}),
+		)
+		nodes, err := renderer.Parse(markdownData)
+		var internalError *mdparser.InternalError
+		if errors.As(err, &internalError) {
+			t.Fatalf("%v\n%s", err, internalError.Stack)
+		}
+		if _, err := json.Marshal(nodes); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
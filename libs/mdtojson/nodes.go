@@ -2,30 +2,55 @@ package mdtojson
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
-
-	ordered "github.com/stencilframe/mdtools/libs/ordered_map"
 )
 
 const (
 	// Node types
-	NodeTypeHeading       = "heading"
-	NodeTypeText          = "text"
-	NodeTypeTable         = "table"
-	NodeTypeLink          = "link"
-	NodeTypeImage         = "image"
-	NodeTypeCode          = "code"
-	NodeTypeCodeBlock     = "codeblock"
-	NodeTypeParagraph     = "paragraph"
-	NodeTypeList          = "list"
-	NodeTypeListItem      = "listitem"
-	NodeTypeBlockquote    = "blockquote"
-	NodeTypeLineBreak     = "linebreak"
-	NodeTypeSoftBreak     = "softbreak"
-	NodeTypeHTMLBlock     = "htmlblock"
-	NodeTypeHTMLSpan      = "htmlspan"
-	NodeTypeLineSeparator = "lineseparator"
+	NodeTypeHeading        = "heading"
+	NodeTypeText           = "text"
+	NodeTypeTable          = "table"
+	NodeTypeLink           = "link"
+	NodeTypeImage          = "image"
+	NodeTypeCode           = "code"
+	NodeTypeCodeBlock      = "codeblock"
+	NodeTypeParagraph      = "paragraph"
+	NodeTypeList           = "list"
+	NodeTypeListItem       = "listitem"
+	NodeTypeBlockquote     = "blockquote"
+	NodeTypeLineBreak      = "linebreak"
+	NodeTypeSoftBreak      = "softbreak"
+	NodeTypeHTMLBlock      = "htmlblock"
+	NodeTypeHTMLSpan       = "htmlspan"
+	NodeTypeLineSeparator  = "lineseparator"
+	NodeTypeEmphasis       = "emphasis"
+	NodeTypeStrong         = "strong"
+	NodeTypeStrikethrough  = "strikethrough"
+	NodeTypeFootnoteRef    = "footnote-ref"
+	NodeTypeFootnoteDef    = "footnote-def"
+	NodeTypeDefinitionList = "definitionlist"
+	NodeTypeTerm           = "term"
+	NodeTypeDefinition     = "definition"
+	NodeTypeCallout        = "callout"
+	NodeTypeContainer      = "container"
+	NodeTypeMath           = "math"
+	NodeTypeMathBlock      = "mathblock"
+	NodeTypeDiagram        = "diagram"
+	NodeTypeEmbed          = "embed"
+	NodeTypeAbbreviation   = "abbreviation"
+)
+
+const (
+	// Link kinds
+	LinkKindInline    = "inline"    // [text](url "title")
+	LinkKindReference = "reference" // [text][label]
+	LinkKindAutolink  = "autolink"  // <https://example.com>
+	LinkKindEmail     = "email"     // <user@example.com>
+	LinkKindWiki      = "wiki"      // [[Page#Section|alias]]
 )
 
 type (
@@ -42,6 +67,64 @@ type (
 		Children []Node `json:"content,omitempty"` // Content of the node
 	}
 
+	// CalloutNode represents a GitHub alert, a blockquote opened by a marker such as [!NOTE]
+	CalloutNode struct {
+		BaseNode
+
+		Kind string `json:"kind"` // note, tip, important, warning or caution
+	}
+
+	// ContainerNode represents a :::name container block, such as :::note or :::details
+	ContainerNode struct {
+		BaseNode
+
+		Name       string            `json:"name"`
+		Title      string            `json:"title,omitempty"`
+		Attributes map[string]string `json:"attributes,omitempty"` // {#id .class key=value} attributes
+	}
+
+	// AbbreviationNode represents an abbreviation of the text with its expansion
+	AbbreviationNode struct {
+		BaseNode
+
+		Abbr  string `json:"abbr"`
+		Title string `json:"title"`
+	}
+
+	// EmbedNode represents a ![[Page#Section]] embed of a page or of one of its sections.
+	// The children hold the transcluded content once resolved.
+	EmbedNode struct {
+		BaseNode
+
+		URL     string `json:"url"`
+		Page    string `json:"page"`
+		Section string `json:"section,omitempty"`
+	}
+
+	// DiagramNode represents a fenced diagram source, such as a mermaid, plantuml or dot block
+	DiagramNode struct {
+		BaseNode
+
+		Language string        `json:"language"`
+		Code     string        `json:"code"`
+		Graph    *DiagramGraph `json:"graph,omitempty"` // Labels and edges of the mermaid flowcharts and sequence diagrams
+	}
+
+	// MathNode represents $inline$ or $$display$$ math within a text
+	MathNode struct {
+		BaseNode
+
+		Math    string `json:"math"` // LaTeX source
+		Display bool   `json:"display,omitempty"`
+	}
+
+	// MathBlockNode represents a display math block
+	MathBlockNode struct {
+		BaseNode
+
+		Math string `json:"math"` // LaTeX source
+	}
+
 	// TextNode represents a parsed text element
 	TextNode struct {
 		BaseNode
@@ -53,8 +136,12 @@ type (
 	HeadingNode struct {
 		BaseNode
 
-		Title string `json:"title"`
-		Level int    `json:"level"`
+		Title  string `json:"title"` // Plain text of the heading
+		Level  int    `json:"level"`
+		ID     string `json:"id"`               // Unique anchor of the heading
+		Inline []Node `json:"inline,omitempty"` // Heading text with its inline markup
+
+		ExplicitID bool `json:"-"` // The ID was set with {#custom-id}
 	}
 
 	// TableNode represents a parsed table element
@@ -65,11 +152,20 @@ type (
 	}
 
 	// LinkNode represents a parsed link element
+	// The children hold the link text with its inline formatting
 	LinkNode struct {
 		BaseNode
 
-		URL   string `json:"url"`
-		Title string `json:"title"`
+		URL     string `json:"url"`
+		Text    string `json:"text"`
+		Title   string `json:"title,omitempty"`
+		Kind    string `json:"kind"`
+		Label   string `json:"label,omitempty"`   // Only for reference links
+		Anchor  string `json:"anchor,omitempty"`  // ID of the heading targeted by an in-document link
+		Page    string `json:"page,omitempty"`    // Only for wiki links
+		Section string `json:"section,omitempty"` // Only for wiki links
+
+		Target *HeadingNode `json:"-"` // Heading targeted by an in-document link
 	}
 
 	// ImageNode represents a parsed image element
@@ -78,7 +174,12 @@ type (
 
 		URL       string `json:"url"`
 		Alt       string `json:"alt"`
-		Reference int    `json:"reference"` // When used as a reference
+		Title     string `json:"title,omitempty"`
+		MIMEType  string `json:"mimeType,omitempty"`
+		Width     int    `json:"width,omitempty"`   // Only known for resolved local images
+		Height    int    `json:"height,omitempty"`  // Only known for resolved local images
+		Reference int    `json:"reference"`         // When used as a reference
+		Dropped   bool   `json:"dropped,omitempty"` // Dropped by a size limit, without URL nor reference
 	}
 
 	// CodeNode represents a parsed code element
@@ -99,6 +200,39 @@ type (
 	// ParagraphNode represents a parsed paragraph element
 	// It has no additional fields, but is used to represent a paragraph
 	ParagraphNode BaseNode
+
+	// FootnoteRefNode represents a reference to a footnote ([^label])
+	FootnoteRefNode struct {
+		BaseNode
+
+		Label string `json:"label"`
+		Index int    `json:"index"` // Number of the footnote in the document
+	}
+
+	// FootnoteDefNode represents a footnote definition ([^label]: text)
+	// The children hold the content of the footnote
+	FootnoteDefNode struct {
+		BaseNode
+
+		Label string `json:"label"`
+		Index int    `json:"index"` // Number of the footnote in the document
+	}
+
+	// DefinitionListNode represents a definition list
+	// The children are terms, each followed by its definitions
+	DefinitionListNode BaseNode
+
+	// TermNode represents a term of a definition list
+	// The children hold the term with its inline formatting
+	TermNode BaseNode
+
+	// DefinitionNode represents a definition of the preceding term
+	// The children hold the blocks of the definition
+	DefinitionNode BaseNode
+
+	// EmphasisNode represents emphasized, strong or strikethrough text,
+	// depending on its type
+	EmphasisNode BaseNode
 )
 
 // --- BaseNode methods ---
@@ -127,6 +261,20 @@ func (n *BaseNode) ToMarkdown() string {
 	return ""
 }
 
+// renderMarkdown concatenates the markdown of the nodes
+func renderMarkdown(nodes []Node) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		sb.WriteString(node.ToMarkdown())
+	}
+	return sb.String()
+}
+
+// markdownTitle returns the title of a link or image destination
+func markdownTitle(title string) string {
+	return ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+}
+
 // --- HeadingNode methods ---
 
 func NewHeadingNode(level int, title string) Node {
@@ -156,7 +304,14 @@ func (n *HeadingNode) ToMarkdown() string {
 	for i := 0; i < n.Level; i++ {
 		level += "#"
 	}
-	return level + " " + n.Title + "\n\n"
+	title := n.Title
+	if len(n.Inline) > 0 {
+		title = renderMarkdown(n.Inline)
+	}
+	if n.ExplicitID {
+		return level + " " + title + " {#" + n.ID + "}\n\n"
+	}
+	return level + " " + title + "\n\n"
 }
 
 // --- TextNode methods ---
@@ -218,61 +373,32 @@ func (n *TableNode) toJSONTable(str string) string {
 	return ":::json_table\n" + str + "\n:::\n\n"
 }
 
-// Split the table into chunks
-func (n *TableNode) ChunkTable(firstChunkLimit, nextChunksLimit int) []string {
+// ChunkTable splits the table into chunks of whole rows, the first chunk being limited
+// to firstChunkLimit characters and the next ones to nextChunksLimit.
+// The rows which cannot be encoded are left out, with their errors joined.
+func (n *TableNode) ChunkTable(firstChunkLimit, nextChunksLimit int) ([]string, error) {
 	chunks := []string{}
-	chunk := ""
-	limit := firstChunkLimit
-
-	switch data := n.Data.(type) {
-	case []*ordered.OrderedMap:
-		for _, row := range data {
-			j, _ := json.Marshal(row)
-			part := string(j) + ",\n"
-			if len(chunk)+len(part) > limit {
-				chunks = append(chunks, n.toJSONTable("[\n"+chunk+"]"))
-				chunk = ""
-				limit = nextChunksLimit
-			}
-			chunk += part
-		}
-	case *ordered.OrderedMap:
-		for key, r := range data.KVIter() {
-			switch row := r.(type) {
-			case *ordered.OrderedMap:
-				j, _ := json.Marshal(row)
-				part := fmt.Sprintf("%q: %s,\n", key, string(j))
-				if len(chunk)+len(part) > limit {
-					chunks = append(chunks, n.toJSONTable("{\n"+chunk+"}"))
-					chunk = ""
-					limit = nextChunksLimit
-				}
-				chunk += part
-			}
-		}
-	}
-
-	if len(chunk) > 0 {
-		switch n.Data.(type) {
-		case []*ordered.OrderedMap:
-			chunks = append(chunks, n.toJSONTable("[\n"+chunk+"]"))
-		case *ordered.OrderedMap:
-			chunks = append(chunks, n.toJSONTable("{\n"+chunk+"}"))
+	var errs []error
+	for chunk, err := range n.Chunks(firstChunkLimit, nextChunksLimit) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		chunks = append(chunks, chunk)
 	}
-
-	return chunks
+	return chunks, errors.Join(errs...)
 }
 
 // --- LinkNode methods ---
 
-func NewLinkNode(url, title string) Node {
+func NewLinkNode(url, text string) Node {
 	return &LinkNode{
 		BaseNode: BaseNode{
 			Type: NodeTypeLink,
 		},
-		URL:   url,
-		Title: title,
+		URL:  url,
+		Text: text,
+		Kind: LinkKindInline,
 	}
 }
 
@@ -289,7 +415,44 @@ func (n *LinkNode) SetChildren(children []Node) {
 }
 
 func (n *LinkNode) ToMarkdown() string {
-	return "[" + n.Title + "](" + n.URL + ")\n\n"
+	text := renderMarkdown(n.Children)
+	if text == "" {
+		text = n.Text
+	}
+
+	switch n.Kind {
+	case LinkKindAutolink:
+		return "<" + n.URL + ">"
+	case LinkKindEmail:
+		return "<" + strings.TrimPrefix(n.URL, "mailto:") + ">"
+	case LinkKindWiki:
+		if n.Text == wikiLinkText(n.Page, n.Section) {
+			return "[[" + wikiLinkTarget(n.Page, n.Section) + "]]"
+		}
+		return "[[" + wikiLinkTarget(n.Page, n.Section) + "|" + n.Text + "]]"
+	case LinkKindReference:
+		if strings.EqualFold(n.Label, n.Text) {
+			return "[" + text + "]"
+		}
+		return "[" + text + "][" + n.Label + "]"
+	default:
+		if n.Title != "" {
+			return "[" + text + "](" + n.URL + markdownTitle(n.Title) + ")"
+		}
+		return "[" + text + "](" + n.URL + ")"
+	}
+}
+
+// ToDefinition returns the [label]: url "title" definition of a reference link,
+// or an empty string for the other kinds of links
+func (n *LinkNode) ToDefinition() string {
+	if n.Kind != LinkKindReference {
+		return ""
+	}
+	if n.Title != "" {
+		return "[" + n.Label + "]: " + n.URL + markdownTitle(n.Title)
+	}
+	return "[" + n.Label + "]: " + n.URL
 }
 
 // --- ImageNode methods ---
@@ -297,7 +460,7 @@ func (n *LinkNode) ToMarkdown() string {
 func NewImageNode(url, alt string) Node {
 	// Cleanup base64 urls as they might contain wrong characters
 	// TODO: this is a bug in the Blackfriday library. Remove this when fixed
-	if len(url) > 5 && url[:5] == "data:" {
+	if isDataURI(url) {
 		url = strings.TrimRight(url, ">")
 	}
 
@@ -323,13 +486,40 @@ func (n *ImageNode) SetChildren(children []Node) {
 }
 
 func (n *ImageNode) ToMarkdown() string {
+	if n.Dropped {
+		return n.ToAltText() + "\n"
+	}
 	return "![Image](" + n.URL + ")\n"
 }
 
+// ToReference returns the {IMG:n} placeholder of the image, or its alt text when it was dropped
 func (n *ImageNode) ToReference() string {
+	if n.Dropped {
+		return n.ToAltText()
+	}
 	return fmt.Sprintf("{IMG:%d}", n.Reference)
 }
 
+// ToInline returns the image as inline markdown, keeping the alt text.
+// A dropped image is written as its alt text.
+func (n *ImageNode) ToInline() string {
+	if n.Dropped {
+		return n.ToAltText()
+	}
+	if n.Title != "" {
+		return "![" + n.Alt + "](" + n.URL + markdownTitle(n.Title) + ")"
+	}
+	return "![" + n.Alt + "](" + n.URL + ")"
+}
+
+// ToAltText returns the alt text of the image as [Image: alt]
+func (n *ImageNode) ToAltText() string {
+	if n.Alt == "" {
+		return "[Image]"
+	}
+	return "[Image: " + n.Alt + "]"
+}
+
 // --- CodeNode methods ---
 
 func NewCodeNode(code string) Node {
@@ -409,3 +599,432 @@ func (n *ParagraphNode) SetChildren(children []Node) {
 func (n *ParagraphNode) ToMarkdown() string {
 	return ""
 }
+
+// --- FootnoteRefNode methods ---
+
+func NewFootnoteRefNode(label string, index int) Node {
+	return &FootnoteRefNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeFootnoteRef,
+		},
+		Label: label,
+		Index: index,
+	}
+}
+
+func (n *FootnoteRefNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *FootnoteRefNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *FootnoteRefNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *FootnoteRefNode) ToMarkdown() string {
+	return "[^" + n.Label + "]"
+}
+
+// --- FootnoteDefNode methods ---
+
+func NewFootnoteDefNode(label string, index int, children []Node) Node {
+	return &FootnoteDefNode{
+		BaseNode: BaseNode{
+			Type:     NodeTypeFootnoteDef,
+			Children: children,
+		},
+		Label: label,
+		Index: index,
+	}
+}
+
+func (n *FootnoteDefNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *FootnoteDefNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *FootnoteDefNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *FootnoteDefNode) ToMarkdown() string {
+	return "[^" + n.Label + "]: "
+}
+
+// --- DefinitionListNode methods ---
+
+func NewDefinitionListNode(children []Node) Node {
+	return &DefinitionListNode{
+		Type:     NodeTypeDefinitionList,
+		Children: children,
+	}
+}
+
+func (n *DefinitionListNode) GetType() string {
+	return n.Type
+}
+
+func (n *DefinitionListNode) GetChildren() []Node {
+	return n.Children
+}
+
+func (n *DefinitionListNode) SetChildren(children []Node) {
+	n.Children = children
+}
+
+// ToMarkdown renders the whole list, using the ": " definition syntax
+func (n *DefinitionListNode) ToMarkdown() string {
+	var sb strings.Builder
+	for i, child := range n.Children {
+		// Separate the definitions from the next term
+		if i > 0 && child.GetType() == NodeTypeTerm {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(child.ToMarkdown())
+	}
+	return sb.String() + "\n"
+}
+
+// --- TermNode methods ---
+
+func NewTermNode(children []Node) Node {
+	return &TermNode{
+		Type:     NodeTypeTerm,
+		Children: children,
+	}
+}
+
+func (n *TermNode) GetType() string {
+	return n.Type
+}
+
+func (n *TermNode) GetChildren() []Node {
+	return n.Children
+}
+
+func (n *TermNode) SetChildren(children []Node) {
+	n.Children = children
+}
+
+func (n *TermNode) ToMarkdown() string {
+	return renderMarkdown(n.Children) + "\n"
+}
+
+// --- DefinitionNode methods ---
+
+func NewDefinitionNode(children []Node) Node {
+	return &DefinitionNode{
+		Type:     NodeTypeDefinition,
+		Children: children,
+	}
+}
+
+func (n *DefinitionNode) GetType() string {
+	return n.Type
+}
+
+func (n *DefinitionNode) GetChildren() []Node {
+	return n.Children
+}
+
+func (n *DefinitionNode) SetChildren(children []Node) {
+	n.Children = children
+}
+
+// ToMarkdown renders the definition, indenting its following paragraphs
+func (n *DefinitionNode) ToMarkdown() string {
+	return ": " + strings.Join(n.Paragraphs(), "\n\n    ") + "\n"
+}
+
+// Paragraphs returns the text of each block of the definition
+func (n *DefinitionNode) Paragraphs() []string {
+	paragraphs := []string{}
+	for _, child := range n.Children {
+		if child.GetType() == NodeTypeParagraph {
+			paragraphs = append(paragraphs, renderMarkdown(child.GetChildren()))
+		} else {
+			paragraphs = append(paragraphs, strings.TrimSpace(child.ToMarkdown()))
+		}
+	}
+	return paragraphs
+}
+
+// --- CalloutNode methods ---
+
+func NewCalloutNode(kind string, children []Node) Node {
+	return &CalloutNode{
+		BaseNode: BaseNode{
+			Type:     NodeTypeCallout,
+			Children: children,
+		},
+		Kind: kind,
+	}
+}
+
+func (n *CalloutNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *CalloutNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *CalloutNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+// ToMarkdown renders the alert marker, the content is rendered by the children
+func (n *CalloutNode) ToMarkdown() string {
+	return "[!" + strings.ToUpper(n.Kind) + "]\n"
+}
+
+// --- ContainerNode methods ---
+
+func NewContainerNode(name, title string, attributes map[string]string, children []Node) Node {
+	return &ContainerNode{
+		BaseNode: BaseNode{
+			Type:     NodeTypeContainer,
+			Children: children,
+		},
+		Name:       name,
+		Title:      title,
+		Attributes: attributes,
+	}
+}
+
+func (n *ContainerNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *ContainerNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *ContainerNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+// ToMarkdown renders the opening fence, the content is rendered by the children
+func (n *ContainerNode) ToMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString(":::" + n.Name)
+
+	if len(n.Attributes) > 0 {
+		attributes := []string{}
+		if id, ok := n.Attributes["id"]; ok {
+			attributes = append(attributes, "#"+id)
+		}
+		for _, class := range strings.Fields(n.Attributes["class"]) {
+			attributes = append(attributes, "."+class)
+		}
+		keys := make([]string, 0, len(n.Attributes))
+		for key := range n.Attributes {
+			if key != "id" && key != "class" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			attributes = append(attributes, key+"="+strconv.Quote(n.Attributes[key]))
+		}
+		sb.WriteString("{" + strings.Join(attributes, " ") + "}")
+	}
+
+	if n.Title != "" {
+		sb.WriteString(" " + n.Title)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// ClosingMarkdown renders the closing fence of the container
+func (n *ContainerNode) ClosingMarkdown() string {
+	return ":::\n\n"
+}
+
+// --- AbbreviationNode methods ---
+
+func NewAbbreviationNode(abbr, title string) Node {
+	return &AbbreviationNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeAbbreviation,
+		},
+		Abbr:  abbr,
+		Title: title,
+	}
+}
+
+func (n *AbbreviationNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *AbbreviationNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *AbbreviationNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *AbbreviationNode) ToMarkdown() string {
+	return n.Abbr
+}
+
+// --- EmbedNode methods ---
+
+func NewEmbedNode(url, page, section string) Node {
+	return &EmbedNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeEmbed,
+		},
+		URL:     url,
+		Page:    page,
+		Section: section,
+	}
+}
+
+func (n *EmbedNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *EmbedNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *EmbedNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *EmbedNode) ToMarkdown() string {
+	return "![[" + wikiLinkTarget(n.Page, n.Section) + "]]"
+}
+
+// --- DiagramNode methods ---
+
+func NewDiagramNode(language, code string) Node {
+	node := &DiagramNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeDiagram,
+		},
+		Language: language,
+		Code:     code,
+	}
+	if strings.EqualFold(diagramLanguage(language), "mermaid") {
+		node.Graph = ParseMermaid(code)
+	}
+	return node
+}
+
+func (n *DiagramNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *DiagramNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *DiagramNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *DiagramNode) ToMarkdown() string {
+	return "```" + n.Language + "\n" + n.Code + "\n```\n\n"
+}
+
+// --- MathNode methods ---
+
+func NewMathNode(math string, display bool) Node {
+	return &MathNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeMath,
+		},
+		Math:    math,
+		Display: display,
+	}
+}
+
+func (n *MathNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *MathNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *MathNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *MathNode) ToMarkdown() string {
+	if n.Display {
+		return "$$" + n.Math + "$$"
+	}
+	return "$" + n.Math + "$"
+}
+
+// --- MathBlockNode methods ---
+
+func NewMathBlockNode(math string) Node {
+	return &MathBlockNode{
+		BaseNode: BaseNode{
+			Type: NodeTypeMathBlock,
+		},
+		Math: math,
+	}
+}
+
+func (n *MathBlockNode) GetType() string {
+	return n.BaseNode.Type
+}
+
+func (n *MathBlockNode) GetChildren() []Node {
+	return n.BaseNode.Children
+}
+
+func (n *MathBlockNode) SetChildren(children []Node) {
+	n.BaseNode.Children = children
+}
+
+func (n *MathBlockNode) ToMarkdown() string {
+	return "$$\n" + n.Math + "\n$$\n\n"
+}
+
+// --- EmphasisNode methods ---
+
+func NewEmphasisNode(t string, children []Node) Node {
+	return &EmphasisNode{
+		Type:     t,
+		Children: children,
+	}
+}
+
+func (n *EmphasisNode) GetType() string {
+	return n.Type
+}
+
+func (n *EmphasisNode) GetChildren() []Node {
+	return n.Children
+}
+
+func (n *EmphasisNode) SetChildren(children []Node) {
+	n.Children = children
+}
+
+func (n *EmphasisNode) ToMarkdown() string {
+	var marker string
+	switch n.Type {
+	case NodeTypeStrong:
+		marker = "**"
+	case NodeTypeStrikethrough:
+		marker = "~~"
+	default:
+		marker = "*"
+	}
+	return marker + renderMarkdown(n.Children) + marker
+}
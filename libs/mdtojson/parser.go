@@ -0,0 +1,103 @@
+package mdtojson
+
+import (
+	"context"
+	"io"
+	"regexp"
+
+	"github.com/stencilframe/mdtools/libs/mdmath"
+	"github.com/stencilframe/mdtools/libs/mdparser"
+)
+
+// Extensions are the default extensions used to parse the markdown,
+// see WithParserConfig to configure the parser
+const Extensions = mdparser.DefaultExtensions
+
+// alertRe matches the GitHub alert marker on the first line of a blockquote, e.g. [!NOTE]
+var alertRe = regexp.MustCompile(`(?i)^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\][ \t]*(?:\n|$)`)
+
+// Result is the result of the conversion of a markdown document
+type Result struct {
+	Nodes    []Node             // Root-level nodes
+	Images   []ImageRef         // Image references, ordered by their reference number
+	Warnings []mdparser.Warning // Non-fatal problems found during the conversion
+}
+
+// Convert converts the markdown data into JSON nodes, with the image references
+// and the warnings of the conversion, see ParseContext for the errors.
+func (r *JSONRenderer) Convert(ctx context.Context, markdownData []byte) (Result, error) {
+	nodes, err := r.ParseContext(ctx, markdownData)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Nodes: nodes, Images: r.GetImageRefs(), Warnings: r.warnings}, nil
+}
+
+// Parse parses the markdown data and returns the JSON nodes, see ParseContext for the errors
+func (r *JSONRenderer) Parse(markdownData []byte) (nodes []Node, err error) {
+	return r.ParseContext(context.Background(), markdownData)
+}
+
+// ParseContext parses the markdown data and returns the JSON nodes.
+// The context is checked between the blocks and the table rows, the conversion returns ctx.Err() once it is done.
+// A document over the input size or the node count of the limits is rejected with a *mdparser.LimitError.
+// An unexpected failure of the conversion is returned as an *mdparser.InternalError.
+// Each call starts a new document, the nodes, image references and warnings of the previous one are cleared.
+func (r *JSONRenderer) ParseContext(ctx context.Context, markdownData []byte) (nodes []Node, err error) {
+	defer mdparser.Recover(&err)
+
+	r.reset()
+
+	r.ctx = ctx
+	defer func() { r.ctx = nil }()
+	r.checkContext()
+	if err := r.config.Limits.CheckInput(markdownData); err != nil {
+		return nil, err
+	}
+	markdownData, replaced := mdparser.ReplaceReserved(markdownData)
+	if replaced > 0 {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningInput, "reserved private use characters U+E000 to U+E002 replaced: %d", replaced))
+	}
+	r.references = mdparser.ExtractReferences(markdownData)
+	markdownData, r.abbreviations = r.config.Preprocess(markdownData)
+	if r.config.Math {
+		markdownData, r.math = mdmath.Protect(markdownData)
+	}
+	if r.wikiLinks != nil {
+		markdownData = r.protectWikiLinks(markdownData)
+	}
+	markdownData = r.extractContainers(markdownData)
+
+	node := r.parseTree(markdownData)
+	r.checkContext()
+
+	// Walk the parsed syntax tree with the renderer
+	node.Walk(func(n *mdparser.Node, entering bool) mdparser.WalkStatus {
+		return r.RenderNode(io.Discard, n, entering)
+	})
+	return r.GetNodes(), nil
+}
+
+// parseTree parses the markdown into a syntax tree within the limits of the configuration,
+// the document and its container blocks share the node budget and the nesting depth.
+// A document over the node count aborts the conversion with a *mdparser.LimitError
+// as soon as the count is reached.
+func (r *JSONRenderer) parseTree(markdownData []byte) *mdparser.Node {
+	r.budget.Max = r.config.Limits.MaxNodes
+	node := r.config.ParserWithBudget(&r.budget).Parse(markdownData, r.references)
+	if removed := r.config.Limits.TruncateDepth(node, r.depth); removed > 0 {
+		r.warnings = append(r.warnings, mdparser.Warnf(mdparser.WarningLimit, "nodes nested deeper than %d dropped: %d", r.config.Limits.MaxDepth, removed))
+	}
+	r.config.Transform(node)
+	return node
+}
+
+// checkContext aborts the conversion with ctx.Err() once the context of the conversion is done
+func (r *JSONRenderer) checkContext() {
+	if r.ctx == nil {
+		return
+	}
+	if err := r.ctx.Err(); err != nil {
+		mdparser.Abort(err)
+	}
+}
@@ -0,0 +1,56 @@
+package mdtojson
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Slugger generates document-wide unique anchor slugs,
+// following the algorithm GitHub uses for heading anchors
+type Slugger struct {
+	seen map[string]int
+}
+
+// NewSlugger creates a new Slugger
+func NewSlugger() *Slugger {
+	return &Slugger{
+		seen: map[string]int{},
+	}
+}
+
+// Slug returns a unique slug for the text, suffixing repeated slugs with -1, -2, ...
+func (s *Slugger) Slug(text string) string {
+	return s.Reserve(Slugify(text))
+}
+
+// Reserve marks the slug as used and returns it, or a unique variant when already used
+func (s *Slugger) Reserve(slug string) string {
+	unique := slug
+	for {
+		if _, ok := s.seen[unique]; !ok {
+			break
+		}
+		s.seen[slug]++
+		unique = slug + "-" + strconv.Itoa(s.seen[slug])
+	}
+	s.seen[unique] = 0
+	return unique
+}
+
+// Slugify converts the text into an anchor slug: lower case, punctuation
+// removed and spaces replaced by hyphens
+func Slugify(text string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case c == ' ':
+			sb.WriteRune('-')
+		case c == '-' || c == '_':
+			sb.WriteRune(c)
+		case unicode.IsLetter(c) || unicode.IsNumber(c) || unicode.IsMark(c):
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
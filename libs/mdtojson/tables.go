@@ -0,0 +1,176 @@
+package mdtojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+	ordered "github.com/stencilframe/mdtools/libs/ordered_map"
+)
+
+// Chunks returns an iterator over the chunks of the table, in the format of ChunkTable.
+// The rows are encoded one at a time into a pooled buffer holding the rows of the current
+// chunk, so that a table is chunked in linear time without rendering all its rows at once.
+// A row which cannot be encoded is left out, its error is yielded in place of a chunk.
+func (n *TableNode) Chunks(firstChunkLimit, nextChunksLimit int) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var opening, closing string
+		switch n.Data.(type) {
+		case []*ordered.OrderedMap:
+			opening, closing = "[\n", "]"
+		case *ordered.OrderedMap:
+			opening, closing = "{\n", "}"
+		default:
+			return
+		}
+
+		buf := mdparser.GetBuffer()
+		defer mdparser.PutBuffer(buf)
+		limit := firstChunkLimit
+		for row, err := range n.encodeRows(buf) {
+			if err != nil {
+				if !yield("", err) {
+					return
+				}
+				continue
+			}
+			// The row is encoded at the end of the buffer, it starts the next chunk when it does not fit
+			if buf.Len() > limit {
+				if !yield(jsonTableChunk(opening, buf.Bytes()[:row], closing), nil) {
+					return
+				}
+				size := copy(buf.Bytes(), buf.Bytes()[row:])
+				buf.Truncate(size)
+				limit = nextChunksLimit
+			}
+		}
+		if buf.Len() > 0 {
+			yield(jsonTableChunk(opening, buf.Bytes(), closing), nil)
+		}
+	}
+}
+
+// jsonTableChunk renders the rows of a table chunk as a json_table block
+func jsonTableChunk(opening string, rows []byte, closing string) string {
+	const fence, end = ":::json_table\n", "\n:::\n\n"
+	var sb strings.Builder
+	sb.Grow(len(fence) + len(opening) + len(rows) + len(closing) + len(end))
+	sb.WriteString(fence)
+	sb.WriteString(opening)
+	sb.Write(rows)
+	sb.WriteString(closing)
+	sb.WriteString(end)
+	return sb.String()
+}
+
+// encodeRows appends the rows of the table to the buffer one at a time, each followed
+// by a comma and a newline, and yields the offset of the row in the buffer or its error
+func (n *TableNode) encodeRows(buf *bytes.Buffer) iter.Seq2[int, error] {
+	return func(yield func(int, error) bool) {
+		rows := newRowEncoder(buf)
+		switch data := n.Data.(type) {
+		case []*ordered.OrderedMap:
+			for i, row := range data {
+				start, err := rows.encode(nil, row)
+				if err != nil {
+					err = fmt.Errorf("table row %d: %w", i+1, err)
+				}
+				if !yield(start, err) {
+					return
+				}
+			}
+		case *ordered.OrderedMap:
+			for key, r := range data.All() {
+				if row, ok := r.(*ordered.OrderedMap); ok {
+					start, err := rows.encode(&key, row)
+					if err != nil {
+						err = fmt.Errorf("table row %q: %w", key, err)
+					}
+					if !yield(start, err) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// rowEncoder writes the rows of a table into a buffer, entry by entry, as json.Marshal
+// encodes the ordered maps. The keys of the cells are the headers repeated on each row,
+// they are encoded once per table.
+type rowEncoder struct {
+	buf  *bytes.Buffer
+	enc  *json.Encoder     // Encoder of the cells, escaping the HTML characters as json.Marshal
+	raw  *json.Encoder     // Encoder of the keys of a keyed table, written without escaping
+	keys map[string]string // Encoded keys of the cells
+}
+
+func newRowEncoder(buf *bytes.Buffer) *rowEncoder {
+	raw := json.NewEncoder(buf)
+	raw.SetEscapeHTML(false)
+	return &rowEncoder{buf: buf, enc: json.NewEncoder(buf), raw: raw, keys: map[string]string{}}
+}
+
+// encode appends a row of a json_table block, with its key when the table is keyed,
+// and returns the offset of the row. A row which cannot be encoded is removed from the buffer.
+func (e *rowEncoder) encode(key *string, row *ordered.OrderedMap) (int, error) {
+	start := e.buf.Len()
+	if key != nil {
+		if err := e.value(e.raw, *key); err != nil {
+			e.buf.Truncate(start)
+			return start, err
+		}
+		e.buf.WriteString(": ")
+	}
+	if row == nil {
+		e.buf.WriteString("null,\n")
+		return start, nil
+	}
+	e.buf.WriteByte('{')
+	first := true
+	for name, cell := range row.All() {
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		if err := e.key(name); err != nil {
+			e.buf.Truncate(start)
+			return start, err
+		}
+		e.buf.WriteByte(':')
+		if err := e.value(e.enc, cell); err != nil {
+			e.buf.Truncate(start)
+			return start, err
+		}
+	}
+	e.buf.WriteString("},\n")
+	return start, nil
+}
+
+// key appends the encoded key of a cell
+func (e *rowEncoder) key(name string) error {
+	encoded, ok := e.keys[name]
+	if !ok {
+		start := e.buf.Len()
+		if err := e.value(e.enc, name); err != nil {
+			return err
+		}
+		encoded = string(e.buf.Bytes()[start:])
+		e.keys[name] = encoded
+		e.buf.Truncate(start)
+	}
+	e.buf.WriteString(encoded)
+	return nil
+}
+
+// value appends the encoded value, without the newline of the encoder
+func (e *rowEncoder) value(enc *json.Encoder, v any) error {
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	e.buf.Truncate(e.buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,202 @@
+package mdtojson
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stencilframe/mdtools/libs/mdparser"
+)
+
+// WikiLinks configures the parsing of the [[Page#Section|alias]] wiki links
+// and the ![[Page#Section]] embeds of Obsidian-flavoured markdown.
+// The link URLs are the escaped page names with the extension, relative to BaseURL.
+type WikiLinks struct {
+	BaseURL   string // Base URL of the pages, the URLs are relative when empty
+	Extension string // File extension of the pages, such as ".md" or ".html"
+}
+
+// WithWikiLinks parses the wiki links and embeds, which are literal text otherwise
+func WithWikiLinks(config WikiLinks) Option {
+	return func(r *JSONRenderer) {
+		r.wikiLinks = &config
+	}
+}
+
+// The placeholders of the wiki links are delimited by U+E002, a private use character which
+// mdparser.ReplaceReserved removes from the document text, and hold the index of the link
+const wikiLinkDelimiter = "\uE002"
+
+var (
+	// wikiLinkRe matches the wiki links and embeds: [[Page]], [[Page#Section|alias]], ![[Page#Section]]
+	wikiLinkRe = regexp.MustCompile(`(!?)\[\[([^\[\]|#\n]*)(?:#([^\[\]|\n]*))?(?:\|([^\[\]\n]*))?\]\]`)
+	// wikiLinkPlaceholderRe matches the placeholders of the wiki links
+	wikiLinkPlaceholderRe = regexp.MustCompile(wikiLinkDelimiter + `(\d+)` + wikiLinkDelimiter)
+)
+
+// wikiLink is a wiki link or embed replaced by a placeholder before parsing
+type wikiLink struct {
+	raw     string // Wiki syntax of the link
+	embed   bool
+	page    string
+	section string
+	alias   string
+}
+
+// wikiLinkText returns the text displayed for a wiki link without alias, such as "Page > Section"
+func wikiLinkText(page, section string) string {
+	switch {
+	case section == "":
+		return page
+	case page == "":
+		return section
+	}
+	return page + " > " + section
+}
+
+// wikiLinkTarget returns the target of a wiki link, such as "Page#Section"
+func wikiLinkTarget(page, section string) string {
+	if section == "" {
+		return page
+	}
+	return page + "#" + section
+}
+
+// text returns the text displayed for the link
+func (l *wikiLink) text() string {
+	if l.alias != "" {
+		return l.alias
+	}
+	return wikiLinkText(l.page, l.section)
+}
+
+// protectWikiLinks replaces the wiki links of the markdown with placeholders.
+// Wiki links in code blocks and code spans are left untouched.
+func (r *JSONRenderer) protectWikiLinks(markdownData []byte) []byte {
+	var output bytes.Buffer
+	for _, line := range mdparser.SplitLines(markdownData) {
+		// Wiki link syntax is literal inside code blocks
+		if line.Code {
+			output.WriteString(line.Text)
+			continue
+		}
+		for part, code := range mdparser.SplitCodeSpans(line.Text) {
+			if code {
+				output.WriteString(part)
+			} else {
+				output.WriteString(r.replaceWikiLinks(part))
+			}
+		}
+	}
+	return output.Bytes()
+}
+
+// replaceWikiLinks replaces the wiki links of a text with placeholders
+func (r *JSONRenderer) replaceWikiLinks(text string) string {
+	return wikiLinkRe.ReplaceAllStringFunc(text, func(match string) string {
+		groups := wikiLinkRe.FindStringSubmatch(match)
+		link := &wikiLink{
+			raw:     match,
+			embed:   groups[1] == "!",
+			page:    strings.TrimSpace(groups[2]),
+			section: strings.TrimSpace(groups[3]),
+			alias:   strings.TrimSpace(groups[4]),
+		}
+		// The alias separator is escaped as \| in the table cells
+		if strings.Contains(match, "|") {
+			if link.section != "" {
+				link.section = strings.TrimSpace(strings.TrimSuffix(link.section, `\`))
+			} else {
+				link.page = strings.TrimSpace(strings.TrimSuffix(link.page, `\`))
+			}
+		}
+		if link.page == "" && link.section == "" {
+			return match
+		}
+		r.wikiLinkRefs = append(r.wikiLinkRefs, link)
+		return wikiLinkDelimiter + strconv.Itoa(len(r.wikiLinkRefs)-1) + wikiLinkDelimiter
+	})
+}
+
+// wikiLink returns the wiki link of a placeholder match
+func (r *JSONRenderer) wikiLink(match string) *wikiLink {
+	index, err := strconv.Atoi(strings.Trim(match, wikiLinkDelimiter))
+	if err != nil || index < 0 || index >= len(r.wikiLinkRefs) {
+		return nil
+	}
+	return r.wikiLinkRefs[index]
+}
+
+// restoreWikiLinks replaces the placeholders of a plain text with the text of the links
+func (r *JSONRenderer) restoreWikiLinks(text string) string {
+	if len(r.wikiLinkRefs) == 0 {
+		return text
+	}
+	return wikiLinkPlaceholderRe.ReplaceAllStringFunc(text, func(match string) string {
+		if link := r.wikiLink(match); link != nil {
+			return link.text()
+		}
+		return match
+	})
+}
+
+// restoreWikiLinkSource replaces the placeholders of a code literal with the wiki syntax of the links
+func (r *JSONRenderer) restoreWikiLinkSource(code string) string {
+	if len(r.wikiLinkRefs) == 0 {
+		return code
+	}
+	return wikiLinkPlaceholderRe.ReplaceAllStringFunc(code, func(match string) string {
+		if link := r.wikiLink(match); link != nil {
+			return link.raw
+		}
+		return match
+	})
+}
+
+// wikiLinkURL returns the URL of a wiki link target, or the #anchor of a section of the document
+func (r *JSONRenderer) wikiLinkURL(page, section string) string {
+	anchor := ""
+	if section != "" {
+		anchor = "#" + Slugify(section)
+	}
+	if page == "" {
+		return anchor
+	}
+	return r.wikiLinks.BaseURL + (&url.URL{Path: page + r.wikiLinks.Extension}).EscapedPath() + anchor
+}
+
+// newWikiLinkNode creates the link or embed node of a wiki link
+func (r *JSONRenderer) newWikiLinkNode(link *wikiLink) Node {
+	destination := r.wikiLinkURL(link.page, link.section)
+	if link.embed {
+		return NewEmbedNode(destination, link.page, link.section)
+	}
+
+	node := NewLinkNode(destination, link.text()).(*LinkNode)
+	node.Kind = LinkKindWiki
+	node.Page = link.page
+	node.Section = link.section
+	if link.page == "" {
+		// Links to a section of the document resolve like the #anchor links
+		r.anchorLinks = append(r.anchorLinks, node)
+	}
+	return node
+}
+
+// handleEmbed returns the embed a placeholder paragraph stands for
+func (r *JSONRenderer) handleEmbed(node *mdparser.Node) (Node, bool) {
+	if node.Type != mdparser.Paragraph || node.FirstChild == nil || node.FirstChild != node.LastChild {
+		return nil, false
+	}
+	literal := strings.TrimSpace(string(node.FirstChild.Literal))
+	if wikiLinkPlaceholderRe.FindString(literal) != literal {
+		return nil, false
+	}
+	link := r.wikiLink(literal)
+	if link == nil || !link.embed {
+		return nil, false
+	}
+	return r.newWikiLinkNode(link), true
+}
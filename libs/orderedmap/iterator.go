@@ -0,0 +1,83 @@
+package orderedmap
+
+import "iter"
+
+// All returns an iterator over the entries of the map, in the insertion order.
+// Setting values and deleting the current entry are allowed during the iteration.
+func (m *OrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for e := m.front; e != nil; e = e.next {
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over the entries of the map, in the reverse insertion order
+func (m *OrderedMap[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for e := m.back; e != nil; e = e.prev {
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of the map, in the insertion order
+func (m *OrderedMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for e := m.front; e != nil; e = e.next {
+			if !yield(e.key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the values of the map, in the insertion order
+func (m *OrderedMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for e := m.front; e != nil; e = e.next {
+			if !yield(e.value) {
+				return
+			}
+		}
+	}
+}
+
+// KVIter returns an iterator over the entries of the map, in the insertion order.
+//
+// Deprecated: use All.
+func (m *OrderedMap[K, V]) KVIter() iter.Seq2[K, V] {
+	return m.All()
+}
+
+// EntriesIter returns a function returning the entries of the map one at a time,
+// in the insertion order, until it returns false
+func (m *OrderedMap[K, V]) EntriesIter() func() (*Pair[K, V], bool) {
+	e := m.front
+	return func() (*Pair[K, V], bool) {
+		if e == nil {
+			return nil, false
+		}
+		pair := &Pair[K, V]{e.key, e.value}
+		e = e.next
+		return pair, true
+	}
+}
+
+// EntriesReverseIter returns a function returning the entries of the map one at a time,
+// in the reverse insertion order, until it returns false
+func (m *OrderedMap[K, V]) EntriesReverseIter() func() (*Pair[K, V], bool) {
+	e := m.back
+	return func() (*Pair[K, V], bool) {
+		if e == nil {
+			return nil, false
+		}
+		pair := &Pair[K, V]{e.key, e.value}
+		e = e.prev
+		return pair, true
+	}
+}
@@ -0,0 +1,218 @@
+package orderedmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// MarshalJSON encodes the map as a JSON object, with the keys in the insertion order.
+// The keys are encoded as encoding/json encodes the keys of a map: strings, integers
+// and encoding.TextMarshaler keys are supported.
+func (m *OrderedMap[K, V]) MarshalJSON() ([]byte, error) {
+	// The keys and the values are encoded into a single buffer, without the newline of the encoder
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	encode := func(v any) error {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+
+	buf.WriteByte('{')
+	for e := m.front; e != nil; e = e.next {
+		key, err := marshalKey(e.key)
+		if err != nil {
+			return nil, err
+		}
+		if err := encode(key); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encode(e.value); err != nil {
+			return nil, err
+		}
+		if e.next != nil {
+			buf.WriteByte(',')
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object into the map, keeping the order of its keys.
+// The numbers of the untyped values are decoded as json.Number, and their objects
+// as ordered maps of string keys.
+func (m *OrderedMap[K, V]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// Must open with a delim token '{'
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expect JSON object open with '{'")
+	}
+
+	if err := m.parseObject(dec); err != nil {
+		return err
+	}
+
+	t, err = dec.Token()
+	if err != io.EOF {
+		return fmt.Errorf("expect end of JSON object but got more token: %T: %v or err: %v", t, t, err)
+	}
+	return nil
+}
+
+// parseObject decodes the entries of an object, after its opening delimiter
+func (m *OrderedMap[K, V]) parseObject(dec *json.Decoder) error {
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("expecting JSON key should be always a string: %T: %v", t, t)
+		}
+		key, err := unmarshalKey[K](name)
+		if err != nil {
+			return err
+		}
+
+		var value V
+		if untyped, ok := any(&value).(*any); ok {
+			// The untyped values keep the order of the nested objects
+			t, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if *untyped, err = parseValue(t, dec); err != nil {
+				return err
+			}
+		} else if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		m.Set(key, value)
+	}
+
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '}' {
+		return fmt.Errorf("expect JSON object close with '}'")
+	}
+	return nil
+}
+
+// parseArray decodes the values of an array, after its opening delimiter
+func parseArray(dec *json.Decoder) ([]any, error) {
+	values := []any{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseValue(t, dec)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != ']' {
+		return nil, fmt.Errorf("expect JSON array close with ']'")
+	}
+	return values, nil
+}
+
+// parseValue decodes an untyped value starting with the token,
+// the objects are decoded as ordered maps of string keys
+func parseValue(t json.Token, dec *json.Decoder) (any, error) {
+	delim, ok := t.(json.Delim)
+	if !ok {
+		return t, nil
+	}
+	switch delim {
+	case '{':
+		object := New[string, any]()
+		if err := object.parseObject(dec); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case '[':
+		return parseArray(dec)
+	}
+	return nil, fmt.Errorf("unexpected delimiter: %q", delim)
+}
+
+// marshalKey returns the JSON object key of a map key
+func marshalKey[K comparable](key K) (string, error) {
+	if s, ok := any(key).(string); ok {
+		return s, nil
+	}
+	v := reflect.ValueOf(key)
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if marshaler, ok := any(key).(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: v.Type()}
+}
+
+// unmarshalKey returns the map key of a JSON object key
+func unmarshalKey[K comparable](name string) (K, error) {
+	var key K
+	if s, ok := any(&key).(*string); ok {
+		*s = name
+		return key, nil
+	}
+	v := reflect.ValueOf(&key).Elem()
+	if v.Kind() == reflect.String {
+		v.SetString(name)
+		return key, nil
+	}
+	if unmarshaler, ok := any(&key).(encoding.TextUnmarshaler); ok {
+		err := unmarshaler.UnmarshalText([]byte(name))
+		return key, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, v.Type().Bits())
+		if err != nil {
+			return key, fmt.Errorf("invalid JSON object key %q for %v: %w", name, v.Type(), err)
+		}
+		v.SetInt(n)
+		return key, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, v.Type().Bits())
+		if err != nil {
+			return key, fmt.Errorf("invalid JSON object key %q for %v: %w", name, v.Type(), err)
+		}
+		v.SetUint(n)
+		return key, nil
+	}
+	return key, &json.UnsupportedTypeError{Type: v.Type()}
+}
@@ -0,0 +1,105 @@
+// Package orderedmap provides a generic map which keeps the insertion order of its keys,
+// and marshals to and from JSON objects in that order.
+package orderedmap
+
+// OrderedMap is a map keeping the insertion order of its keys, the single key operations run in O(1).
+// The zero value is an empty map ready to use. It is not safe for concurrent use.
+type OrderedMap[K comparable, V any] struct {
+	entries     map[K]*entry[K, V]
+	front, back *entry[K, V] // First and last entries in the insertion order
+}
+
+// entry is an element of the doubly linked list of the entries, in the insertion order
+type entry[K comparable, V any] struct {
+	key        K
+	value      V
+	prev, next *entry[K, V]
+}
+
+// Pair is a key and its value, to initialize a map or to loop over its entries
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// New creates an empty map
+func New[K comparable, V any]() *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{entries: map[K]*entry[K, V]{}}
+}
+
+// FromPairs creates a map holding the pairs, in their order
+func FromPairs[K comparable, V any](pairs []*Pair[K, V]) *OrderedMap[K, V] {
+	m := New[K, V]()
+	for _, pair := range pairs {
+		m.Set(pair.Key, pair.Value)
+	}
+	return m
+}
+
+// Len returns the number of entries of the map
+func (m *OrderedMap[K, V]) Len() int {
+	return len(m.entries)
+}
+
+// Set sets the value of the key, a new key is added after the existing ones
+// and an existing key keeps its position
+func (m *OrderedMap[K, V]) Set(key K, value V) {
+	if e, ok := m.entries[key]; ok {
+		e.value = value
+		return
+	}
+	if m.entries == nil {
+		m.entries = map[K]*entry[K, V]{}
+	}
+	e := &entry[K, V]{key: key, value: value, prev: m.back}
+	if m.back != nil {
+		m.back.next = e
+	} else {
+		m.front = e
+	}
+	m.back = e
+	m.entries[key] = e
+}
+
+// Has reports whether the key is in the map
+func (m *OrderedMap[K, V]) Has(key K) bool {
+	_, ok := m.entries[key]
+	return ok
+}
+
+// Get returns the value of the key, or the zero value when the key is not in the map
+func (m *OrderedMap[K, V]) Get(key K) V {
+	value, _ := m.GetValue(key)
+	return value
+}
+
+// GetValue returns the value of the key and whether the key is in the map
+func (m *OrderedMap[K, V]) GetValue(key K) (value V, ok bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Delete removes the key from the map and returns its value, deleting a missing key is a no-op.
+// The entry being iterated can be deleted, the iteration goes on with the next entries.
+func (m *OrderedMap[K, V]) Delete(key K) (value V, ok bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		return value, false
+	}
+	// The links of the entry are kept for the iterations positioned on it
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		m.front = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		m.back = e.prev
+	}
+	delete(m.entries, key)
+	return e.value, true
+}
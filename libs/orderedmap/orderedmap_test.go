@@ -0,0 +1,110 @@
+package orderedmap
+
+import (
+	"encoding/json"
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// entries collects the entries of an iterator as pairs
+func entries[K comparable, V any](seq iter.Seq2[K, V]) []Pair[K, V] {
+	pairs := []Pair[K, V]{}
+	for key, value := range seq {
+		pairs = append(pairs, Pair[K, V]{key, value})
+	}
+	return pairs
+}
+
+func TestOrderedMap(t *testing.T) {
+	// The zero value is ready to use
+	var m OrderedMap[int, string]
+	assert.Equal(t, 0, m.Len())
+	m.Set(3, "c")
+	m.Set(1, "a")
+	m.Set(2, "b")
+	m.Set(3, "C") // Keeps its position
+
+	assert.Equal(t, 3, m.Len())
+	assert.True(t, m.Has(1))
+	assert.False(t, m.Has(4))
+	assert.Equal(t, "C", m.Get(3))
+	assert.Equal(t, "", m.Get(4))
+	value, ok := m.GetValue(2)
+	assert.True(t, ok)
+	assert.Equal(t, "b", value)
+
+	assert.Equal(t, []Pair[int, string]{{3, "C"}, {1, "a"}, {2, "b"}}, entries(m.All()))
+	assert.Equal(t, []Pair[int, string]{{2, "b"}, {1, "a"}, {3, "C"}}, entries(m.Backward()))
+	assert.Equal(t, []int{3, 1, 2}, slices.Collect(m.Keys()))
+	assert.Equal(t, []string{"C", "a", "b"}, slices.Collect(m.Values()))
+
+	pairs := []Pair[int, string]{}
+	next := m.EntriesReverseIter()
+	for pair, ok := next(); ok; pair, ok = next() {
+		pairs = append(pairs, *pair)
+	}
+	assert.Equal(t, []Pair[int, string]{{2, "b"}, {1, "a"}, {3, "C"}}, pairs)
+
+	value, ok = m.Delete(1)
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+	_, ok = m.Delete(1)
+	assert.False(t, ok)
+	m.Set(1, "A") // Added at the end
+	assert.Equal(t, []int{3, 2, 1}, slices.Collect(m.Keys()))
+
+	// The current entry can be deleted while iterating
+	for key := range m.Keys() {
+		if key != 2 {
+			m.Delete(key)
+		}
+	}
+	assert.Equal(t, []Pair[int, string]{{2, "b"}}, entries(m.All()))
+	assert.Equal(t, []Pair[int, string]{{2, "b"}}, entries(m.Backward()))
+}
+
+func TestJSON(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	m := FromPairs([]*Pair[int, point]{{10, point{1, 2}}, {-5, point{3, 4}}})
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"10":{"X":1,"Y":2},"-5":{"X":3,"Y":4}}`, string(data))
+
+	// The typed values are decoded as their type
+	decoded := New[int, point]()
+	assert.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, m, decoded)
+
+	// The untyped objects are decoded as ordered maps, and the numbers as json.Number
+	untyped := New[string, any]()
+	assert.NoError(t, json.Unmarshal([]byte(`{"b": {"z": 1, "a": [true, null]}, "a": "x"}`), untyped))
+	assert.Equal(t, []string{"b", "a"}, slices.Collect(untyped.Keys()))
+	nested, ok := untyped.Get("b").(*OrderedMap[string, any])
+	if assert.True(t, ok) {
+		assert.Equal(t, []Pair[string, any]{{"z", json.Number("1")}, {"a", []any{true, nil}}}, entries(nested.All()))
+	}
+
+	// A repeated key keeps its first position with its last value
+	repeated := New[string, any]()
+	assert.NoError(t, json.Unmarshal([]byte(`{"a": 1, "b": 2, "a": 3}`), repeated))
+	assert.Equal(t, []Pair[string, any]{{"a", json.Number("3")}, {"b", json.Number("2")}}, entries(repeated.All()))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"x": {"X": 1}}`), New[int, point]()))
+	assert.Error(t, json.Unmarshal([]byte(`{"1": "x"}`), New[int, point]()))
+	_, err = json.Marshal(FromPairs([]*Pair[float64, int]{{1.5, 1}}))
+	assert.Error(t, err)
+
+	// The keys are escaped as encoding/json escapes the keys of a map
+	for _, key := range []string{"<a&b>", "k\x01\x7f", "k\xff", "k\u00e9\u2028", `"\\`} {
+		data, err = json.Marshal(FromPairs([]*Pair[string, int]{{key, 1}}))
+		assert.NoError(t, err)
+		expected, err := json.Marshal(map[string]int{key: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(data), key)
+	}
+}
@@ -1,31 +1,51 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
 	"github.com/stencilframe/mdtools/libs/mdchunk"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 )
 
 func main() {
+	config := mdparser.RegisterFlags(flag.CommandLine)
+	timeout := flag.Duration("timeout", 0, "maximum duration of the conversion, 0 for no limit")
+	flag.Parse()
+
 	// Check if a file was provided as an argument
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		log.Fatal("Please provide a markdown file as an argument")
 	}
 
 	// Read the markdown file
-	markdownFile := os.Args[1]
+	markdownFile := flag.Arg(0)
 	markdownData, err := os.ReadFile(markdownFile)
 	if err != nil {
 		log.Fatalf("Error reading file: %v", err)
 	}
 
-	chunker := mdchunk.NewDefaultMarkdownChunk()
-	chunks, images := chunker.ChunkMarkdown(markdownData)
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	chunker := mdchunk.NewDefaultMarkdownChunk(mdchunk.WithParserConfig(config))
+	result, err := chunker.Convert(ctx, markdownData)
+	if err != nil {
+		log.Fatalf("Error chunking file: %v", err)
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
 
-	for i, chunk := range chunks {
+	for i, chunk := range result.Chunks {
 		chunk = strings.TrimSpace(chunk)
 		os.Stdout.WriteString(chunk)
 		l := len(chunk)
@@ -34,7 +54,7 @@ func main() {
 
 	// Print the images
 	fmt.Println("\n\n--- IMAGES ---")
-	for ref, img := range images {
-		fmt.Printf("%s: %s\n", ref, img)
+	for _, img := range result.Images {
+		fmt.Printf("%s: %s\n", img.ToReference(), img.URL)
 	}
 }
@@ -1,34 +1,55 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"log"
 	"os"
 
-	"github.com/russross/blackfriday/v2"
+	"github.com/stencilframe/mdtools/libs/mdparser"
 	"github.com/stencilframe/mdtools/libs/mdtojson"
 )
 
 func main() {
+	config := mdparser.RegisterFlags(flag.CommandLine)
+	timeout := flag.Duration("timeout", 0, "maximum duration of the conversion, 0 for no limit")
+	flag.Parse()
+
 	// Check if a file was provided as an argument
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		log.Fatal("Please provide a markdown file as an argument")
 	}
 
 	// Read the markdown file
-	markdownFile := os.Args[1]
+	markdownFile := flag.Arg(0)
 	markdownData, err := os.ReadFile(markdownFile)
 	if err != nil {
 		log.Fatalf("Error reading file: %v", err)
 	}
 
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
 	// Initialize a new JSONRenderer
-	renderer := mdtojson.NewJSONRenderer()
+	renderer := mdtojson.NewJSONRenderer(mdtojson.WithParserConfig(config))
 
 	// Convert the markdown to JSON
-	out := blackfriday.Run(markdownData,
-		blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.AutoHeadingIDs|blackfriday.Tables),
-		blackfriday.WithRenderer(renderer),
-	)
+	result, err := renderer.Convert(ctx, markdownData)
+	if err != nil {
+		log.Fatalf("Error converting file: %v", err)
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	out, err := json.MarshalIndent(result.Nodes, "", "  ")
+	if err != nil {
+		log.Fatalf("Error generating JSON: %v", err)
+	}
 
 	// Write the JSON to stdout
 	os.Stdout.Write(out)